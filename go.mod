@@ -2,6 +2,9 @@ module github.com/apptweak/concourse-slack-chat-resources
 
 go 1.25
 
-require github.com/slack-go/slack v0.23.1
+require (
+	github.com/slack-go/slack v0.23.1
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require github.com/gorilla/websocket v1.5.3 // indirect
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
 )
 
 func main() {
@@ -31,6 +33,6 @@ func main() {
 }
 
 func fatal(doing string, err error) {
-	fmt.Fprintf(os.Stderr, "Error "+doing+": "+err.Error()+"\n")
+	fmt.Fprintf(utils.Log, "Error %s: %s\n", doing, err)
 	os.Exit(1)
 }
@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
 )
 
 func main() {
@@ -25,6 +27,7 @@ func main() {
 
 	// Extract timestamp from version which may be a string or a map[string]interface{}
 	var timestamp string
+	var scheduled_id string
 	if v, ok := request["version"]; ok {
 		switch vv := v.(type) {
 		case string:
@@ -33,6 +36,9 @@ func main() {
 			if ts, ok := vv["timestamp"].(string); ok {
 				timestamp = ts
 			}
+			if id, ok := vv["scheduled_message_id"].(string); ok {
+				scheduled_id = id
+			}
 		}
 	}
 	if timestamp == "" {
@@ -46,6 +52,13 @@ func main() {
 		}
 	}
 
+	if scheduled_id != "" {
+		err := ioutil.WriteFile(filepath.Join(destination, "scheduled_message_id"), []byte(scheduled_id), 0644)
+		if err != nil {
+			fatal("writing scheduled_message_id file", err)
+		}
+	}
+
 	{
 		err := json.NewEncoder(os.Stdout).Encode(&response)
 		if err != nil {
@@ -55,6 +68,6 @@ func main() {
 }
 
 func fatal(doing string, err error) {
-	fmt.Fprintf(os.Stderr, "Error "+doing+": "+err.Error()+"\n")
+	fmt.Fprintf(utils.Log, "Error %s: %s\n", doing, err)
 	os.Exit(1)
 }
@@ -0,0 +1,26 @@
+// Package postresource implements the Slack post resource: posting, updating,
+// scheduling and deleting messages (put).
+package postresource
+
+import (
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// Client is the part of the Slack API used by the post resource, implemented
+// by *slack.Client.
+type Client interface {
+	utils.ChannelLister
+	AuthTest() (*slack.AuthTestResponse, error)
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	PostEphemeral(channelID string, userID string, options ...slack.MsgOption) (string, error)
+	ScheduleMessage(channelID string, postAt string, options ...slack.MsgOption) (string, string, error)
+	DeleteScheduledMessage(params *slack.DeleteScheduledMessageParameters) (bool, error)
+	UpdateMessage(channelID string, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+	DeleteMessage(channel string, messageTimestamp string) (string, string, error)
+	GetConversationReplies(params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error)
+	OpenConversation(params *slack.OpenConversationParameters) (*slack.Channel, bool, bool, error)
+	GetUserByEmail(email string) (*slack.User, error)
+	UploadFile(params slack.UploadFileParameters) (*slack.FileSummary, error)
+	AddReaction(name string, item slack.ItemRef) error
+}
@@ -0,0 +1,177 @@
+package postresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+)
+
+// interpolator substitutes variables in a message string.
+type interpolator func(text string) (string, error)
+
+// new_interpolator returns the interpolator selected by params.template_engine.
+func new_interpolator(template_engine string, source_dir string) (interpolator, error) {
+	switch template_engine {
+	case "":
+		return func(text string) (string, error) { return interpolate(text, source_dir) }, nil
+	case "go":
+		return new_template_renderer(source_dir), nil
+	default:
+		return nil, fmt.Errorf("unknown params field value: template_engine: %s", template_engine)
+	}
+}
+
+func interpolate_message(message *utils.OutMessage, interpolate_text interpolator) error {
+	var err error
+
+	message.Text, err = interpolate_text(message.Text)
+	if err != nil {
+		return err
+	}
+
+	message.ThreadTimestamp, err = interpolate_text(message.ThreadTimestamp)
+	if err != nil {
+		return err
+	}
+
+	if len(message.Blocks.BlockSet) > 0 {
+		message.Blocks, err = interpolate_json(message.Blocks, interpolate_text)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(message.Attachments) > 0 {
+		message.Attachments, err = interpolate_json(message.Attachments, interpolate_text)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(message.MetaData.EventType) > 0 {
+		message.MetaData, err = interpolate_json(message.MetaData, interpolate_text)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// interpolate_json interpolates every string nested in value, walking its
+// JSON representation so that blocks of any type are supported.
+func interpolate_json[T any](value T, interpolate_text interpolator) (T, error) {
+	var result T
+
+	data, marshal_err := json.Marshal(value)
+	if marshal_err != nil {
+		return result, fmt.Errorf("encoding message for interpolation: %w", marshal_err)
+	}
+
+	var tree interface{}
+	tree_err := json.Unmarshal(data, &tree)
+	if tree_err != nil {
+		return result, fmt.Errorf("decoding message for interpolation: %w", tree_err)
+	}
+
+	tree, interpolate_err := interpolate_tree(tree, interpolate_text)
+	if interpolate_err != nil {
+		return result, interpolate_err
+	}
+
+	data, marshal_err = json.Marshal(tree)
+	if marshal_err != nil {
+		return result, fmt.Errorf("encoding interpolated message: %w", marshal_err)
+	}
+
+	result_err := json.Unmarshal(data, &result)
+	if result_err != nil {
+		return result, fmt.Errorf("decoding interpolated message: %w", result_err)
+	}
+
+	return result, nil
+}
+
+func interpolate_tree(node interface{}, interpolate_text interpolator) (interface{}, error) {
+	var err error
+
+	switch value := node.(type) {
+	case string:
+		return interpolate_text(value)
+	case []interface{}:
+		for i := range value {
+			value[i], err = interpolate_tree(value[i], interpolate_text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for key := range value {
+			value[key], err = interpolate_tree(value[key], interpolate_text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return node, nil
+}
+
+// interpolate substitutes {{path}} with the contents of the file at path in
+// the source directory, and {{$NAME}} with the value of environment variable NAME.
+func interpolate(text string, source_dir string) (string, error) {
+
+	var out_text string
+
+	start_var := 0
+	end_var := 0
+	inside_var := false
+	c0 := '_'
+
+	for pos, c1 := range text {
+		if inside_var {
+			if c0 == '}' && c1 == '}' {
+				inside_var = false
+				end_var = pos + 1
+
+				var value string
+
+				if text[start_var+2] == '$' {
+					var_name := text[start_var+3 : end_var-2]
+					value = os.Getenv(var_name)
+				} else {
+					var_name := text[start_var+2 : end_var-2]
+					contents, err := get_file_contents(filepath.Join(source_dir, var_name))
+					if err != nil {
+						return "", err
+					}
+					value = contents
+				}
+
+				out_text += value
+			}
+		} else {
+			if c0 == '{' && c1 == '{' {
+				inside_var = true
+				start_var = pos - 1
+				out_text += text[end_var:start_var]
+			}
+		}
+		c0 = c1
+	}
+
+	out_text += text[end_var:]
+
+	return out_text, nil
+}
+
+func get_file_contents(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading file: %w", err)
+	}
+
+	return string(data), nil
+}
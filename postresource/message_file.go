@@ -0,0 +1,146 @@
+package postresource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+	"gopkg.in/yaml.v3"
+)
+
+// read_message decodes the contents of a message file, which may hold, in
+// JSON or YAML, either a chat.postMessage payload (such as the output of the
+// Block Kit Builder) or a bare array of blocks.
+func read_message(path string, contents string, message *utils.OutMessage) error {
+	tree, decode_err := decode_message_tree(path, contents)
+	if decode_err != nil {
+		return decode_err
+	}
+
+	if blocks, ok := tree.([]interface{}); ok {
+		tree = map[string]interface{}{"blocks": blocks}
+	}
+
+	object, ok := tree.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected a message object or an array of blocks")
+	}
+
+	validate_err := validate_message_tree(object)
+	if validate_err != nil {
+		return validate_err
+	}
+
+	data, encode_err := json.Marshal(object)
+	if encode_err != nil {
+		return encode_err
+	}
+
+	unmarshal_err := json.Unmarshal(data, message)
+	if unmarshal_err != nil {
+		var type_err *json.UnmarshalTypeError
+		if errors.As(unmarshal_err, &type_err) {
+			return fmt.Errorf("field %s: expected %s, got %s", type_err.Field, type_err.Type, type_err.Value)
+		}
+		return unmarshal_err
+	}
+
+	return nil
+}
+
+// decode_message_tree parses the message file as JSON or YAML, depending on
+// its extension, or its contents when the extension is not conclusive.
+func decode_message_tree(path string, contents string) (interface{}, error) {
+	var tree interface{}
+
+	is_json := false
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		is_json = true
+	case ".yml", ".yaml":
+		is_json = false
+	default:
+		trimmed := strings.TrimSpace(contents)
+		is_json = strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+	}
+
+	if is_json {
+		err := json.Unmarshal([]byte(contents), &tree)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		err := yaml.Unmarshal([]byte(contents), &tree)
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	}
+
+	return tree, nil
+}
+
+// validate_message_tree checks blocks and attachments one at a time, so that
+// errors point to the offending element.
+func validate_message_tree(object map[string]interface{}) error {
+	if text, ok := object["text"]; ok {
+		if _, ok := text.(string); !ok {
+			return fmt.Errorf("field text: expected a string")
+		}
+	}
+
+	if blocks, ok := object["blocks"]; ok {
+		list, ok := blocks.([]interface{})
+		if !ok {
+			return fmt.Errorf("field blocks: expected an array of blocks")
+		}
+
+		for i, block := range list {
+			fields, ok := block.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("field blocks[%d]: expected an object", i)
+			}
+
+			block_type, ok := fields["type"].(string)
+			if !ok || len(block_type) == 0 {
+				return fmt.Errorf("field blocks[%d]: missing block type", i)
+			}
+
+			data, encode_err := json.Marshal([]interface{}{block})
+			if encode_err != nil {
+				return fmt.Errorf("field blocks[%d]: %w", i, encode_err)
+			}
+
+			var decoded slack.Blocks
+			decode_err := json.Unmarshal(data, &decoded)
+			if decode_err != nil {
+				return fmt.Errorf("field blocks[%d] (%s): %w", i, block_type, decode_err)
+			}
+		}
+	}
+
+	if attachments, ok := object["attachments"]; ok {
+		list, ok := attachments.([]interface{})
+		if !ok {
+			return fmt.Errorf("field attachments: expected an array of attachments")
+		}
+
+		for i, attachment := range list {
+			data, encode_err := json.Marshal(attachment)
+			if encode_err != nil {
+				return fmt.Errorf("field attachments[%d]: %w", i, encode_err)
+			}
+
+			var decoded slack.Attachment
+			decode_err := json.Unmarshal(data, &decoded)
+			if decode_err != nil {
+				return fmt.Errorf("field attachments[%d]: %w", i, decode_err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package postresource
+
+import (
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+)
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		path     string
+		contents string
+		text     string
+		blocks   int
+	}{
+		{"message.json", `{"text": "hi"}`, "hi", 0},
+		{"message.json", `{"blocks": [{"type": "divider"}]}`, "", 1},
+		{"blocks.json", `[{"type": "divider"}, {"type": "divider"}]`, "", 2},
+		{"message.yml", "text: hi\nblocks:\n  - type: divider\n", "hi", 1},
+		{"message", "text: hi\n", "hi", 0},
+		{"message", `{"text": "hi"}`, "hi", 0},
+		// Files without text, blocks or attachments are left for Slack to
+		// accept or reject, as they always were.
+		{"message.json", `{"thread_ts": "1234.5678", "metadata": {"event_type": "deploy", "event_payload": {}}}`, "", 0},
+		{"message.json", `{}`, "", 0},
+	}
+
+	for _, test := range tests {
+		var message utils.OutMessage
+		if err := read_message(test.path, test.contents, &message); err != nil {
+			t.Errorf("read_message(%s, %s) failed: %s", test.path, test.contents, err)
+			continue
+		}
+		if message.Text != test.text || len(message.Blocks.BlockSet) != test.blocks {
+			t.Errorf("read_message(%s, %s) = %q with %d blocks, want %q with %d blocks",
+				test.path, test.contents, message.Text, len(message.Blocks.BlockSet), test.text, test.blocks)
+		}
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		path     string
+		contents string
+	}{
+		{"message.json", `{"text": "unterminated}`},
+		{"message.yml", "text: [unterminated\n"},
+		{"message.json", `"just a string"`},
+		{"message.json", `{"text": 42}`},
+		{"message.json", `{"blocks": [{"text": "no type"}]}`},
+		{"message.json", `{"blocks": {"type": "divider"}}`},
+		{"message.json", `{"attachments": [{"fields": "not a list"}]}`},
+	}
+
+	for _, test := range tests {
+		var message utils.OutMessage
+		if err := read_message(test.path, test.contents, &message); err == nil {
+			t.Errorf("read_message(%s, %s) succeeded, want an error", test.path, test.contents)
+		}
+	}
+}
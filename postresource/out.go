@@ -0,0 +1,660 @@
+package postresource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// Put posts, updates, schedules or deletes messages as requested by the
+// params, reading files referenced by the params from source_dir.
+func Put(request *utils.OutRequest, source_dir string, slack_client Client) (utils.OutResponse, error) {
+
+	var response utils.OutResponse
+
+	request = request.Clone()
+
+	err := validate(request)
+	if err != nil {
+		return response, err
+	}
+
+	interpolate_text, err := new_interpolator(request.Params.TemplateEngine, source_dir)
+	if err != nil {
+		return response, err
+	}
+
+	message, err := read_request_message(request, source_dir, interpolate_text)
+	if err != nil {
+		return response, err
+	}
+
+	if message != nil {
+		fmt.Fprintf(utils.Log, "About to send this message:\n")
+		m, _ := json.MarshalIndent(message, "", "  ")
+		fmt.Fprintf(utils.Log, "%s\n", m)
+	}
+
+	if len(request.Source.ChannelId) > 0 || len(request.Source.ChannelName) > 0 {
+		err = request.Source.ResolveChannelId(slack_client)
+		if err != nil {
+			return response, fmt.Errorf("resolving channel: %w", err)
+		}
+	}
+
+	channels, err := target_channels(request, interpolate_text, slack_client)
+	if err != nil {
+		return response, err
+	}
+
+	// The first channel is the primary one, used by the version, uploads and reactions.
+	request.Source.ChannelId = channels[0]
+
+	if message != nil {
+		// send message
+		if len(request.Params.EphemeralUser) > 0 {
+			user, err := interpolate_text(request.Params.EphemeralUser)
+			if err != nil {
+				return response, err
+			}
+			user_id, err := lookup_user_id(strings.TrimSpace(user), slack_client)
+			if err != nil {
+				return response, err
+			}
+			response, err = send_ephemeral(message, channels, user_id, slack_client)
+			if err != nil {
+				return response, err
+			}
+		} else if len(request.Params.PostAt) > 0 {
+			value, err := interpolate_text(request.Params.PostAt)
+			if err != nil {
+				return response, err
+			}
+			post_at, err := parse_post_at(value, time.Now())
+			if err != nil {
+				return response, err
+			}
+			response, err = schedule(message, channels, post_at, slack_client)
+			if err != nil {
+				return response, err
+			}
+		} else if len(request.Params.Ts) == 0 {
+			response, err = send(message, channels, slack_client)
+			if err != nil {
+				return response, err
+			}
+		} else {
+			request.Params.Ts, err = get_file_contents(filepath.Join(source_dir, request.Params.Ts))
+			if err != nil {
+				return response, err
+			}
+			response, err = update(message, request, slack_client)
+			if err != nil {
+				return response, err
+			}
+		}
+
+		//Attach file
+		if request.Params.Upload != nil {
+			err = uploadFile(&response, request, slack_client, source_dir)
+			if err != nil {
+				return response, err
+			}
+		}
+
+		// Add emoji reactions to the posted/updated message
+		if len(request.Params.EmojiReactions) > 0 {
+			ts := response.Version["timestamp"]
+			fmt.Fprintf(utils.Log, "Adding emoji reactions to the posted/updated message ts=%s %+v\n", ts, request.Params.EmojiReactions)
+			addReactions(slack_client, request.Source.ChannelId, ts, request.Params.EmojiReactions)
+		}
+
+		// Add emoji reactions to the thread parent (message.thread_ts) if provided
+		if message.ThreadTimestamp != "" && len(request.Params.ThreadEmojiReactions) > 0 {
+			fmt.Fprintf(utils.Log, "Adding emoji reactions to the thread parent: ts=%s %+v\n", message.ThreadTimestamp, request.Params.ThreadEmojiReactions)
+			addReactions(slack_client, request.Source.ChannelId, message.ThreadTimestamp, request.Params.ThreadEmojiReactions)
+		}
+	}
+
+	// Delete a message, e.g. a transient one now superseded by the message above
+	if len(request.Params.DeleteTs) > 0 {
+		delete_ts, err := get_file_contents(filepath.Join(source_dir, request.Params.DeleteTs))
+		if err != nil {
+			return response, err
+		}
+		delete_ts = strings.TrimSpace(delete_ts)
+
+		err = delete_message(delete_ts, request, slack_client)
+		if err != nil {
+			return response, err
+		}
+
+		if message == nil {
+			response.Version = utils.Version{"timestamp": delete_ts}
+		}
+		response.Metadata = append(response.Metadata, utils.MetadataField{Name: "deleted", Value: delete_ts})
+	}
+
+	// Cancel a message scheduled by a previous put
+	if len(request.Params.CancelScheduled) > 0 {
+		scheduled_id, err := get_file_contents(filepath.Join(source_dir, request.Params.CancelScheduled))
+		if err != nil {
+			return response, err
+		}
+		scheduled_id = strings.TrimSpace(scheduled_id)
+		fmt.Fprintf(utils.Log, "Cancelling scheduled message: %s\n", scheduled_id)
+
+		_, err = slack_client.DeleteScheduledMessage(&slack.DeleteScheduledMessageParameters{
+			Channel:            request.Source.ChannelId,
+			ScheduledMessageID: scheduled_id,
+		})
+		if err != nil {
+			return response, fmt.Errorf("cancelling scheduled message: %w", err)
+		}
+
+		if response.Version == nil {
+			response.Version = utils.Version{
+				"timestamp":            strconv.FormatInt(time.Now().Unix(), 10),
+				"scheduled_message_id": scheduled_id,
+			}
+		}
+		response.Metadata = append(response.Metadata, utils.MetadataField{Name: "cancelled", Value: scheduled_id})
+	}
+
+	return response, nil
+}
+
+// validate checks that the source and params describe a single action.
+func validate(request *utils.OutRequest) error {
+
+	if len(request.Source.ChannelId) == 0 && len(request.Source.ChannelName) == 0 &&
+		len(request.Params.Channels) == 0 && len(request.Params.DmUsers) == 0 {
+		return errors.New("missing source field: channel_id or channel_name, or params field: channels or dm_users")
+	}
+
+	if (len(request.Params.Channels) > 0 || len(request.Params.DmUsers) > 0) && len(request.Params.Ts) > 0 {
+		return errors.New("params fields channels and dm_users cannot be used together with update_ts")
+	}
+
+	if len(request.Params.MessageFile) == 0 && request.Params.Message == nil &&
+		len(request.Params.DeleteTs) == 0 && len(request.Params.CancelScheduled) == 0 {
+		return errors.New("missing params field: message, message_file, delete_ts or cancel_scheduled")
+	}
+
+	if len(request.Params.PostAt) > 0 && (len(request.Params.Ts) > 0 || request.Params.Upload != nil || len(request.Params.EmojiReactions) > 0) {
+		return errors.New("params field post_at cannot be used together with update_ts, upload or emoji_reactions")
+	}
+
+	if len(request.Params.EphemeralUser) > 0 && (len(request.Params.PostAt) > 0 || len(request.Params.Ts) > 0 ||
+		request.Params.Upload != nil || len(request.Params.EmojiReactions) > 0) {
+		return errors.New("params field ephemeral_user cannot be used together with post_at, update_ts, upload or emoji_reactions")
+	}
+
+	return nil
+}
+
+// read_request_message returns the interpolated message given by
+// params.message or params.message_file, or nil if there is none.
+func read_request_message(request *utils.OutRequest, source_dir string, interpolate_text interpolator) (*utils.OutMessage, error) {
+
+	if len(request.Params.MessageFile) != 0 {
+		message := new(utils.OutMessage)
+
+		contents, err := get_file_contents(filepath.Join(source_dir, request.Params.MessageFile))
+		if err != nil {
+			return nil, err
+		}
+
+		err = read_message(request.Params.MessageFile, contents, message)
+		if err != nil {
+			return nil, fmt.Errorf("reading message file: %w", err)
+		}
+
+		// Strings are rendered once the file is decoded, so that values with
+		// quotes or newlines cannot break its JSON or YAML syntax.
+		if request.Params.InterpolateMessageFile || request.Params.TemplateEngine == "go" {
+			err = interpolate_message(message, interpolate_text)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return message, nil
+	}
+
+	if request.Params.Message != nil {
+		err := interpolate_message(request.Params.Message, interpolate_text)
+		if err != nil {
+			return nil, err
+		}
+		return request.Params.Message, nil
+	}
+
+	return nil, nil
+}
+
+func update(message *utils.OutMessage, request *utils.OutRequest, slack_client Client) (utils.OutResponse, error) {
+
+	var response utils.OutResponse
+
+	fmt.Fprintf(utils.Log, "About to post an update message: %s\n", request.Params.Ts)
+	_, timestamp, _, err := slack_client.UpdateMessage(request.Source.ChannelId,
+		request.Params.Ts,
+		message_options(message)...)
+
+	if err != nil {
+		return response, fmt.Errorf("sending: %w", err)
+	}
+
+	response.Version = utils.Version{"timestamp": timestamp}
+	return response, nil
+}
+
+// message_options returns the options posting the whole message: text,
+// blocks, attachments and the other chat.postMessage parameters.
+func message_options(message *utils.OutMessage) []slack.MsgOption {
+	options := []slack.MsgOption{
+		slack.MsgOptionText(message.Text, false),
+		slack.MsgOptionAttachments(message.Attachments...),
+		slack.MsgOptionPostMessageParameters(message.PostMessageParameters),
+	}
+
+	if len(message.Blocks.BlockSet) > 0 {
+		options = append(options, slack.MsgOptionBlocks(message.Blocks.BlockSet...))
+	}
+
+	return options
+}
+
+// delete_message deletes the message with the given timestamp and, with
+// params.delete_thread, the replies posted by the resource's bot in its thread.
+func delete_message(timestamp string, request *utils.OutRequest, slack_client Client) error {
+
+	if request.Params.DeleteThread {
+		auth, auth_err := slack_client.AuthTest()
+		if auth_err != nil {
+			return fmt.Errorf("identifying the bot: %w", auth_err)
+		}
+
+		params := slack.GetConversationRepliesParameters{
+			ChannelID: request.Source.ChannelId,
+			Timestamp: timestamp,
+		}
+
+		for {
+			replies, has_more, cursor, err := slack_client.GetConversationReplies(&params)
+			if err != nil {
+				return fmt.Errorf("getting replies: %w", err)
+			}
+
+			for _, reply := range replies {
+				is_own := reply.Msg.User == auth.UserID || (len(auth.BotID) > 0 && reply.Msg.BotID == auth.BotID)
+				if reply.Msg.Timestamp == timestamp || !is_own {
+					continue
+				}
+
+				fmt.Fprintf(utils.Log, "Deleting reply: %s\n", reply.Msg.Timestamp)
+				_, _, err := slack_client.DeleteMessage(request.Source.ChannelId, reply.Msg.Timestamp)
+				if err != nil {
+					return fmt.Errorf("deleting reply %s: %w", reply.Msg.Timestamp, err)
+				}
+			}
+
+			if !has_more || len(cursor) == 0 {
+				break
+			}
+			params.Cursor = cursor
+		}
+	}
+
+	fmt.Fprintf(utils.Log, "Deleting message: %s\n", timestamp)
+	_, _, err := slack_client.DeleteMessage(request.Source.ChannelId, timestamp)
+	if err != nil {
+		return fmt.Errorf("deleting message: %w", err)
+	}
+
+	return nil
+}
+
+// target_channels returns the IDs of the channels to post to: the source
+// channel, followed by the interpolated params channels.
+func target_channels(request *utils.OutRequest, interpolate_text interpolator, slack_client Client) ([]string, error) {
+	channels := []string{}
+	seen := map[string]bool{}
+
+	add := func(channel string) {
+		if len(channel) > 0 && !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+
+	add(request.Source.ChannelId)
+
+	for _, entry := range request.Params.Channels {
+		channel, err := interpolate_text(entry)
+		if err != nil {
+			return nil, err
+		}
+		channel = strings.TrimSpace(channel)
+
+		if strings.HasPrefix(channel, "#") {
+			id, err := utils.FindChannelId(slack_client, channel)
+			if err != nil {
+				return nil, fmt.Errorf("resolving channel: %w", err)
+			}
+			channel = id
+		}
+		add(channel)
+	}
+
+	for _, entry := range request.Params.DmUsers {
+		user, err := interpolate_text(entry)
+		if err != nil {
+			return nil, err
+		}
+		user = strings.TrimSpace(user)
+		if len(user) == 0 {
+			continue
+		}
+
+		channel, err := open_dm(user, slack_client)
+		if err != nil {
+			return nil, err
+		}
+		add(channel)
+	}
+
+	if len(channels) == 0 {
+		return nil, errors.New("no channel to post to")
+	}
+
+	return channels, nil
+}
+
+// lookup_user_id returns the ID of a user given by ID or email address.
+func lookup_user_id(user string, slack_client Client) (string, error) {
+	if !strings.Contains(user, "@") {
+		return user, nil
+	}
+
+	info, err := slack_client.GetUserByEmail(user)
+	if err != nil {
+		return "", fmt.Errorf("looking up user %s: %w", user, err)
+	}
+
+	fmt.Fprintf(utils.Log, "User %s is %s\n", user, info.ID)
+
+	return info.ID, nil
+}
+
+// open_dm returns the ID of the direct message channel with a user, given by
+// ID or email address (e.g. the contents of a git resource's committer file).
+func open_dm(user string, slack_client Client) (string, error) {
+	// Accept "Name <email>" as well as a bare email.
+	if start, end := strings.Index(user, "<"), strings.LastIndex(user, ">"); start >= 0 && end > start {
+		user = strings.TrimSpace(user[start+1 : end])
+	}
+
+	user_id, err := lookup_user_id(user, slack_client)
+	if err != nil {
+		return "", err
+	}
+
+	channel, _, _, err := slack_client.OpenConversation(&slack.OpenConversationParameters{Users: []string{user_id}})
+	if err != nil {
+		return "", fmt.Errorf("opening direct message with %s: %w", user_id, err)
+	}
+
+	return channel.ID, nil
+}
+
+func send(message *utils.OutMessage, channels []string, slack_client Client) (utils.OutResponse, error) {
+
+	var response utils.OutResponse
+
+	if len(channels) == 1 {
+		_, timestamp, err := slack_client.PostMessage(channels[0], message_options(message)...)
+
+		if err != nil {
+			return response, fmt.Errorf("sending: %w", err)
+		}
+
+		response.Version = utils.Version{"timestamp": timestamp}
+		return response, nil
+	}
+
+	failures := []string{}
+
+	for i, channel := range channels {
+		_, timestamp, err := slack_client.PostMessage(channel, message_options(message)...)
+
+		if err != nil {
+			fmt.Fprintf(utils.Log, "Error sending to channel %s: %s\n", channel, err)
+			failures = append(failures, channel+" ("+err.Error()+")")
+			continue
+		}
+
+		fmt.Fprintf(utils.Log, "Sent to channel %s: ts=%s\n", channel, timestamp)
+
+		if i == 0 {
+			response.Version = utils.Version{"timestamp": timestamp}
+		}
+		response.Metadata = append(response.Metadata, utils.MetadataField{Name: "message", Value: channel + ":" + timestamp})
+	}
+
+	if len(failures) > 0 {
+		return response, fmt.Errorf("failed sending to %d of %d channels: %s", len(failures), len(channels), strings.Join(failures, ", "))
+	}
+
+	return response, nil
+}
+
+// parse_post_at returns the Unix time of params.post_at, given as RFC3339,
+// Unix time in whole seconds, or relative to now (e.g. "+2h").
+func parse_post_at(post_at string, now time.Time) (string, error) {
+	value := strings.TrimSpace(post_at)
+
+	var at time.Time
+
+	if strings.HasPrefix(value, "+") {
+		delay, err := time.ParseDuration(value[1:])
+		if err != nil {
+			return "", fmt.Errorf("parsing params field post_at: %w", err)
+		}
+		at = now.Add(delay)
+	} else if is_digits(value) {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("parsing params field post_at: %w", err)
+		}
+		at = time.Unix(seconds, 0)
+	} else {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", fmt.Errorf("parsing params field post_at: %w", err)
+		}
+		at = parsed
+	}
+
+	if !at.After(now) {
+		return "", fmt.Errorf("params field post_at must be in the future: %s", at.Format(time.RFC3339))
+	}
+
+	return strconv.FormatInt(at.Unix(), 10), nil
+}
+
+func is_digits(value string) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// schedule is the counterpart of send for params.post_at, using chat.scheduleMessage.
+func schedule(message *utils.OutMessage, channels []string, post_at string, slack_client Client) (utils.OutResponse, error) {
+
+	var response utils.OutResponse
+
+	for i, channel := range channels {
+		_, scheduled_id, err := slack_client.ScheduleMessage(channel, post_at, message_options(message)...)
+
+		if err != nil {
+			return response, fmt.Errorf("scheduling message in channel %s: %w", channel, err)
+		}
+
+		fmt.Fprintf(utils.Log, "Scheduled in channel %s at %s: %s\n", channel, post_at, scheduled_id)
+
+		if i == 0 {
+			response.Version = utils.Version{"timestamp": post_at, "scheduled_message_id": scheduled_id}
+		}
+		response.Metadata = append(response.Metadata, utils.MetadataField{Name: "scheduled_message_id", Value: channel + ":" + scheduled_id})
+	}
+
+	return response, nil
+}
+
+// send_ephemeral is the counterpart of send for params.ephemeral_user, using
+// chat.postEphemeral. Ephemeral messages cannot be fetched, updated or
+// reacted to later on, so the version only records when it was sent.
+func send_ephemeral(message *utils.OutMessage, channels []string, user_id string, slack_client Client) (utils.OutResponse, error) {
+
+	var response utils.OutResponse
+
+	for i, channel := range channels {
+		timestamp, err := slack_client.PostEphemeral(channel, user_id, message_options(message)...)
+
+		if err != nil {
+			return response, fmt.Errorf("sending ephemeral message in channel %s: %w", channel, err)
+		}
+
+		fmt.Fprintf(utils.Log, "Sent ephemeral message to %s in channel %s: ts=%s\n", user_id, channel, timestamp)
+
+		if i == 0 {
+			response.Version = utils.Version{"timestamp": timestamp, "ephemeral_user": user_id}
+		}
+		response.Metadata = append(response.Metadata, utils.MetadataField{Name: "ephemeral", Value: channel + ":" + timestamp})
+	}
+
+	return response, nil
+}
+
+func uploadFile(response *utils.OutResponse, request *utils.OutRequest, slack_client Client, source_dir string) error {
+	// initialise UploadFileParameters
+	params := slack.UploadFileParameters{
+		Filename:        request.Params.Upload.FileName,
+		Title:           request.Params.Upload.Title,
+		SnippetType:     request.Params.Upload.FileType,
+		ThreadTimestamp: response.Version["timestamp"],
+		Channel:         firstChannelID(request.Params.Upload.Channels),
+	}
+	// If no specific channel is provided for the upload, use the main channel ID
+	if params.Channel == "" {
+		params.Channel = request.Source.ChannelId
+	}
+
+	if request.Params.Upload.File != "" {
+		matched, glob_err := filepath.Glob(filepath.Join(source_dir, request.Params.Upload.File))
+		if glob_err != nil {
+			return fmt.Errorf("globbing upload file pattern: %w", glob_err)
+		}
+		if len(matched) == 0 {
+			return fmt.Errorf("no file matched the pattern: %s", request.Params.Upload.File)
+		}
+
+		params.File = matched[0]
+		if params.Filename == "" {
+			params.Filename = filepath.Base(params.File)
+		}
+		info, stat_err := os.Stat(params.File)
+		if stat_err != nil {
+			return fmt.Errorf("stat upload file: %w", stat_err)
+		}
+		params.FileSize = int(info.Size())
+		fmt.Fprintf(utils.Log, "About to upload: %s\n", params.File)
+	} else if request.Params.Upload.Content != "" {
+		params.Content = request.Params.Upload.Content
+		params.FileSize = len([]byte(request.Params.Upload.Content))
+		if params.Filename == "" {
+			return errors.New("upload.filename is required when uploading content")
+		}
+		fmt.Fprintf(utils.Log, "About to upload specify content as file\n")
+	} else {
+		fmt.Fprintf(utils.Log, "You must either set Upload.Content or provide a local file path in Upload.File to upload it from your filesystem.\n")
+		return nil
+	}
+
+	p, _ := json.MarshalIndent(params, "", "  ")
+	fmt.Fprintf(utils.Log, "%s\n", p)
+
+	file, err := slack_client.UploadFile(params)
+	if err != nil {
+		fmt.Fprintf(utils.Log, "Error: %s\n", err)
+		return nil
+	}
+
+	// UploadFile returns a FileSummary; URLPrivate is not included.
+	fmt.Fprintf(utils.Log, "Uploaded file: ID=%s, Name=%s\n", file.ID, file.Title)
+
+	response.Metadata = append(response.Metadata, utils.MetadataField{Name: file.Title, Value: file.ID})
+
+	return nil
+}
+
+func firstChannelID(channels string) string {
+	for _, channel := range strings.Split(channels, ",") {
+		if id := strings.TrimSpace(channel); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func addReactions(slack_client Client, channelId string, timestamp string, emojis []string) {
+	if timestamp == "" || len(emojis) == 0 {
+		return
+	}
+	ref := slack.NewRefToMessage(channelId, timestamp)
+	for _, emoji := range emojis {
+		if emoji == "" {
+			continue
+		}
+
+		if err := slack_client.AddReaction(sanitizeEmojiName(emoji), ref); err != nil {
+			// Ignore if the reaction is already present
+			if strings.Contains(err.Error(), "already_reacted") {
+				continue
+			}
+			fmt.Fprintf(utils.Log, "Error adding reaction to timestamp %s: %s\n", timestamp, err)
+		}
+	}
+}
+
+// sanitizeEmojiName removes a single leading and/or trailing colon while preserving
+// internal colons (e.g., :thumbsup:). It also trims surrounding whitespace.
+func sanitizeEmojiName(name string) string {
+	n := strings.TrimSpace(name)
+	if n == "" {
+		return ""
+	}
+	if strings.HasPrefix(n, ":") && len(n) > 1 {
+		n = n[1:]
+	}
+	if strings.HasSuffix(n, ":") && len(n) > 1 {
+		n = n[:len(n)-1]
+	}
+	return n
+}
@@ -0,0 +1,580 @@
+package postresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+const channel = "C00000001"
+
+func out_request(t *testing.T, params string) *utils.OutRequest {
+	t.Helper()
+
+	var request utils.OutRequest
+	payload := fmt.Sprintf(`{"source": {}, "params": %s}`, params)
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		t.Fatalf("parsing request: %s", err)
+	}
+	request.Source.ChannelId = channel
+	return &request
+}
+
+func out_message(t *testing.T, message string) *utils.OutMessage {
+	t.Helper()
+
+	var result utils.OutMessage
+	if err := json.Unmarshal([]byte(message), &result); err != nil {
+		t.Fatalf("parsing message: %s", err)
+	}
+	return &result
+}
+
+func write_file(t *testing.T, dir string, name string, contents string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("creating %s: %s", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("writing %s: %s", name, err)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "version/number", "1.2.3")
+	write_file(t, source_dir, "repo/commit", "abc123")
+	t.Setenv("BUILD_JOB_NAME", "deploy")
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{"", ""},
+		{"v{{version/number}}", "v1.2.3"},
+		{"{{version/number}} at {{repo/commit}}", "1.2.3 at abc123"},
+		{"job {{$BUILD_JOB_NAME}} done", "job deploy done"},
+		{"{{$UNSET_VARIABLE}}", ""},
+		{"single { brace } stays", "single { brace } stays"},
+	}
+
+	for _, test := range tests {
+		got, err := interpolate(test.text, source_dir)
+		if err != nil {
+			t.Errorf("interpolate(%q) failed: %s", test.text, err)
+		} else if got != test.want {
+			t.Errorf("interpolate(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestInterpolateMessage(t *testing.T) {
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "version/number", "1.2.3")
+
+	message := out_message(t, `{
+		"text": "Released {{version/number}}",
+		"thread_ts": "{{version/number}}",
+		"blocks": [
+			{"type": "section", "text": {"type": "mrkdwn", "text": "*{{version/number}}*"}}
+		],
+		"attachments": [{"title": "v{{version/number}}"}]
+	}`)
+
+	err := interpolate_message(message, func(text string) (string, error) { return interpolate(text, source_dir) })
+	if err != nil {
+		t.Fatalf("interpolate_message() failed: %s", err)
+	}
+
+	if message.Text != "Released 1.2.3" {
+		t.Errorf("text = %q, want %q", message.Text, "Released 1.2.3")
+	}
+	if message.ThreadTimestamp != "1.2.3" {
+		t.Errorf("thread_ts = %q, want %q", message.ThreadTimestamp, "1.2.3")
+	}
+
+	section, ok := message.Blocks.BlockSet[0].(*slack.SectionBlock)
+	if !ok {
+		t.Fatalf("block is a %T, want a section", message.Blocks.BlockSet[0])
+	}
+	if section.Text.Text != "*1.2.3*" {
+		t.Errorf("block text = %q, want %q", section.Text.Text, "*1.2.3*")
+	}
+
+	if message.Attachments[0].Title != "v1.2.3" {
+		t.Errorf("attachment title = %q, want %q", message.Attachments[0].Title, "v1.2.3")
+	}
+}
+
+func TestSend(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	message := out_message(t, `{
+		"text": "Deployed",
+		"blocks": [{"type": "section", "text": {"type": "plain_text", "text": "Deployed"}}]
+	}`)
+
+	response, err := send(message, []string{channel}, server.Client())
+	if err != nil {
+		t.Fatalf("send() failed: %s", err)
+	}
+
+	posted := server.Message(channel, response.Version["timestamp"])
+	if posted == nil {
+		t.Fatalf("no message posted at %s", response.Version["timestamp"])
+	}
+	if posted.Text != "Deployed" || len(posted.Blocks.BlockSet) != 1 {
+		t.Errorf("posted text %q with %d blocks, want %q with 1 block", posted.Text, len(posted.Blocks.BlockSet), "Deployed")
+	}
+	if len(response.Metadata) != 0 {
+		t.Errorf("metadata = %v, want none for a single channel", response.Metadata)
+	}
+}
+
+func TestSendSeveralChannels(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	channels := []string{channel, "C00000002", "C00000003"}
+	response, err := send(out_message(t, `{"text": "Deployed"}`), channels, server.Client())
+	if err != nil {
+		t.Fatalf("send() failed: %s", err)
+	}
+
+	if len(response.Metadata) != len(channels) {
+		t.Fatalf("metadata = %v, want one entry per channel", response.Metadata)
+	}
+
+	for i, channel := range channels {
+		messages := server.Messages(channel)
+		if len(messages) != 1 || messages[0].Text != "Deployed" {
+			t.Errorf("channel %s has messages %v, want the posted one", channel, messages)
+			continue
+		}
+
+		want := channel + ":" + messages[0].Timestamp
+		if response.Metadata[i].Name != "message" || response.Metadata[i].Value != want {
+			t.Errorf("metadata[%d] = %v, want message %s", i, response.Metadata[i], want)
+		}
+		if i == 0 && response.Version["timestamp"] != messages[0].Timestamp {
+			t.Errorf("version = %v, want the timestamp in the first channel", response.Version)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	ts := server.Post(channel, fakeslack.BotUserId, "Deploying", "")
+
+	request := out_request(t, fmt.Sprintf(`{"update_ts": %q}`, ts))
+	message := out_message(t, `{"text": "Deployed"}`)
+
+	response, err := update(message, request, server.Client())
+	if err != nil {
+		t.Fatalf("update() failed: %s", err)
+	}
+
+	if response.Version["timestamp"] != ts {
+		t.Errorf("version = %v, want timestamp %s", response.Version, ts)
+	}
+
+	updated := server.Message(channel, ts)
+	if updated.Text != "Deployed" || updated.Edited == nil {
+		t.Errorf("message is %q (edited: %v), want the updated text", updated.Text, updated.Edited != nil)
+	}
+	if len(server.Messages(channel)) != 1 {
+		t.Errorf("channel has %d messages, want the updated one only", len(server.Messages(channel)))
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "reports/report-42.txt", "all tests passed")
+
+	tests := []struct {
+		name     string
+		upload   string
+		filename string
+		content  string
+	}{
+		{
+			name:     "content",
+			upload:   `{"content": "inline log", "filename": "build.log", "title": "Build log"}`,
+			filename: "build.log",
+			content:  "inline log",
+		},
+		{
+			name:     "file",
+			upload:   `{"file": "reports/report-*.txt", "title": "Report"}`,
+			filename: "report-42.txt",
+			content:  "all tests passed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakeslack.New()
+			defer server.Close()
+
+			ts := server.Post(channel, fakeslack.BotUserId, "Deployed", "")
+
+			request := out_request(t, fmt.Sprintf(`{"upload": %s}`, test.upload))
+			response := utils.OutResponse{Version: utils.Version{"timestamp": ts}}
+
+			err := uploadFile(&response, request, server.Client(), source_dir)
+			if err != nil {
+				t.Fatalf("uploadFile() failed: %s", err)
+			}
+
+			uploads := server.Uploads()
+			if len(uploads) != 1 {
+				t.Fatalf("uploaded %d files, want 1", len(uploads))
+			}
+
+			upload := uploads[0]
+			if upload.Filename != test.filename || upload.Content != test.content {
+				t.Errorf("uploaded %s with %q, want %s with %q", upload.Filename, upload.Content, test.filename, test.content)
+			}
+			if upload.Channel != channel || upload.ThreadTs != ts {
+				t.Errorf("uploaded to %s in thread %s, want %s in thread %s", upload.Channel, upload.ThreadTs, channel, ts)
+			}
+			if len(response.Metadata) != 1 || response.Metadata[0].Value != upload.FileId {
+				t.Errorf("metadata = %v, want the uploaded file %s", response.Metadata, upload.FileId)
+			}
+		})
+	}
+}
+
+func TestPut(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "version/number", "1.2.3")
+
+	request := out_request(t, `{
+		"message": {"text": "Released {{version/number}}"},
+		"emoji_reactions": [":rocket:"]
+	}`)
+
+	response, err := Put(request, source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	posted := server.Message(channel, response.Version["timestamp"])
+	if posted == nil {
+		t.Fatalf("no message posted at %s", response.Version["timestamp"])
+	}
+	if posted.Text != "Released 1.2.3" {
+		t.Errorf("posted %q, want %q", posted.Text, "Released 1.2.3")
+	}
+	if len(posted.Reactions) != 1 || posted.Reactions[0].Name != "rocket" {
+		t.Errorf("reactions = %v, want rocket", posted.Reactions)
+	}
+}
+
+func TestPutErrors(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{name: "no message", params: `{}`},
+		{name: "channels with update_ts", params: `{"message": {"text": "hi"}, "channels": ["C2"], "update_ts": "ts"}`},
+		{name: "post_at with upload", params: `{"message": {"text": "hi"}, "post_at": "+1h", "upload": {"content": "x"}}`},
+		{name: "post_at with update_ts", params: `{"message": {"text": "hi"}, "post_at": "+1h", "update_ts": "slack-out/timestamp"}`},
+		{name: "post_at with emoji_reactions", params: `{"message": {"text": "hi"}, "post_at": "+1h", "emoji_reactions": ["eyes"]}`},
+		{name: "post_at in the past", params: `{"message": {"text": "hi"}, "post_at": "1000000000"}`},
+		{name: "malformed post_at", params: `{"message": {"text": "hi"}, "post_at": "NaN"}`},
+		{name: "ephemeral_user with post_at", params: `{"message": {"text": "hi"}, "ephemeral_user": "U1", "post_at": "+1h"}`},
+		{name: "ephemeral_user with update_ts", params: `{"message": {"text": "hi"}, "ephemeral_user": "U1", "update_ts": "slack-out/timestamp"}`},
+		{name: "ephemeral_user with upload", params: `{"message": {"text": "hi"}, "ephemeral_user": "U1", "upload": {"content": "x"}}`},
+		{name: "ephemeral_user with emoji_reactions", params: `{"message": {"text": "hi"}, "ephemeral_user": "U1", "emoji_reactions": ["eyes"]}`},
+		{name: "unknown ephemeral_user", params: `{"message": {"text": "hi"}, "ephemeral_user": "nobody@example.com"}`},
+		{name: "dm_users with update_ts", params: `{"message": {"text": "hi"}, "dm_users": ["U1"], "update_ts": "slack-out/timestamp"}`},
+		{name: "unknown dm_users", params: `{"message": {"text": "hi"}, "dm_users": ["nobody@example.com"]}`},
+		{name: "missing delete_ts file", params: `{"delete_ts": "slack-out/timestamp"}`},
+		{name: "missing cancel_scheduled file", params: `{"cancel_scheduled": "slack-out/scheduled_message_id"}`},
+		{name: "unknown template engine", params: `{"message": {"text": "hi"}, "template_engine": "jinja"}`},
+		{name: "missing file", params: `{"message": {"text": "{{missing/file}}"}}`},
+		{name: "slack error", params: `{"message": {"text": "hi"}, "channels": ["C_MISSING"]}`},
+	}
+
+	server.Fail("chat.postMessage", "channel_not_found")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Put(out_request(t, test.params), t.TempDir(), server.Client())
+			if err == nil {
+				t.Errorf("Put(%s) succeeded, want an error", test.params)
+			}
+		})
+	}
+}
+
+func TestSanitizeEmojiName(t *testing.T) {
+	tests := map[string]string{
+		"thumbsup":          "thumbsup",
+		":thumbsup:":        "thumbsup",
+		" :rocket: ":        "rocket",
+		":+1::skin-tone-2:": "+1::skin-tone-2",
+		"":                  "",
+	}
+
+	for name, want := range tests {
+		if got := sanitizeEmojiName(name); got != want {
+			t.Errorf("sanitizeEmojiName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParsePostAt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		post_at string
+		want    string
+	}{
+		{"+2h", "1700007200"},
+		{" +90s ", "1700000090"},
+		{"1700003600", "1700003600"},
+		{"2023-11-15T00:13:20+01:00", "1700003600"},
+	}
+
+	for _, test := range tests {
+		got, err := parse_post_at(test.post_at, now)
+		if err != nil {
+			t.Errorf("parse_post_at(%q) failed: %s", test.post_at, err)
+		} else if got != test.want {
+			t.Errorf("parse_post_at(%q) = %s, want %s", test.post_at, got, test.want)
+		}
+	}
+
+	// Malformed, or not in the future.
+	failures := []string{"2023-11-14T23:13:20+01:00", "1700000000", "", "NaN", "Inf", "1e10", "0x1p31", "1700003600.5", "+1700003600", "-5", "+-1h", "tomorrow", "99999999999999999999"}
+
+	for _, post_at := range failures {
+		if got, err := parse_post_at(post_at, now); err == nil {
+			t.Errorf("parse_post_at(%q) = %s, want an error", post_at, got)
+		}
+	}
+}
+
+func TestPutSchedule(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	source_dir := t.TempDir()
+
+	response, err := Put(out_request(t, `{"message": {"text": "Standup"}, "post_at": "+1h"}`), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	scheduled := server.Scheduled()
+	if len(scheduled) != 1 || scheduled[0].Channel != channel || scheduled[0].Text != "Standup" {
+		t.Fatalf("scheduled = %+v, want the message in %s", scheduled, channel)
+	}
+	want := utils.Version{"timestamp": scheduled[0].PostAt, "scheduled_message_id": scheduled[0].Id}
+	if fmt.Sprint(response.Version) != fmt.Sprint(want) {
+		t.Errorf("version = %v, want %v", response.Version, want)
+	}
+	if len(server.Messages(channel)) != 0 {
+		t.Errorf("messages = %v, want none posted yet", server.Messages(channel))
+	}
+
+	write_file(t, source_dir, "slack-reminder/scheduled_message_id", scheduled[0].Id+"\n")
+
+	response, err = Put(out_request(t, `{"cancel_scheduled": "slack-reminder/scheduled_message_id"}`), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	if len(server.Scheduled()) != 0 {
+		t.Errorf("scheduled = %+v, want it cancelled", server.Scheduled())
+	}
+	if response.Version["scheduled_message_id"] != scheduled[0].Id {
+		t.Errorf("version = %v, want the cancelled message", response.Version)
+	}
+	if len(response.Metadata) != 1 || response.Metadata[0].Name != "cancelled" {
+		t.Errorf("metadata = %v, want the cancelled message", response.Metadata)
+	}
+
+	_, err = Put(out_request(t, `{"cancel_scheduled": "slack-reminder/scheduled_message_id"}`), source_dir, server.Client())
+	if err == nil {
+		t.Errorf("Put() cancelling twice succeeded, want an error")
+	}
+}
+
+func TestPutEphemeral(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.AddUser("U2", "bob@example.com")
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "slack-in/user", "bob@example.com\n")
+
+	request := out_request(t, `{"message": {"text": "Only for you"}, "ephemeral_user": "{{slack-in/user}}"}`)
+
+	response, err := Put(request, source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	ephemerals := server.Ephemerals()
+	if len(ephemerals) != 1 || ephemerals[0].User != "U2" || ephemerals[0].Channel != channel || ephemerals[0].Text != "Only for you" {
+		t.Fatalf("ephemerals = %+v, want one to U2 in %s", ephemerals, channel)
+	}
+	want := utils.Version{"timestamp": ephemerals[0].Ts, "ephemeral_user": "U2"}
+	if fmt.Sprint(response.Version) != fmt.Sprint(want) {
+		t.Errorf("version = %v, want %v", response.Version, want)
+	}
+	if len(server.Messages(channel)) != 0 {
+		t.Errorf("messages = %v, want none in the channel history", server.Messages(channel))
+	}
+}
+
+func TestPutDirectMessages(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.AddUser("U4", "carol@example.com")
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "git/committer", "Carol <carol@example.com>\n")
+
+	request := out_request(t, `{"message": {"text": "Your build broke"}, "dm_users": ["U3", "{{git/committer}}", "U3"]}`)
+
+	response, err := Put(request, source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	for _, target := range []string{channel, fakeslack.DirectChannel("U3"), fakeslack.DirectChannel("U4")} {
+		messages := server.Messages(target)
+		if len(messages) != 1 || messages[0].Text != "Your build broke" {
+			t.Errorf("messages in %s = %v, want the message once", target, messages)
+		}
+	}
+
+	if response.Version["timestamp"] != server.Messages(channel)[0].Timestamp {
+		t.Errorf("version = %v, want the message in the source channel", response.Version)
+	}
+	if len(response.Metadata) != 3 {
+		t.Errorf("metadata = %v, want the 3 messages", response.Metadata)
+	}
+}
+
+func TestPutDelete(t *testing.T) {
+	tests := []struct {
+		name          string
+		delete_thread bool
+		kept          []string
+	}{
+		{name: "message", delete_thread: false, kept: []string{"user reply", "bot reply"}},
+		{name: "thread", delete_thread: true, kept: []string{"user reply"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakeslack.New()
+			defer server.Close()
+
+			parent := server.Post(channel, fakeslack.BotUserId, "Deploying...", "")
+			server.Post(channel, "U1", "user reply", parent)
+			server.Add(channel, slack.Message{Msg: slack.Msg{User: fakeslack.BotUserId, BotID: fakeslack.BotId, Text: "bot reply", ThreadTimestamp: parent}})
+
+			source_dir := t.TempDir()
+			write_file(t, source_dir, "slack-out/timestamp", parent+"\n")
+
+			params := fmt.Sprintf(`{"delete_ts": "slack-out/timestamp", "delete_thread": %t}`, test.delete_thread)
+			response, err := Put(out_request(t, params), source_dir, server.Client())
+			if err != nil {
+				t.Fatalf("Put() failed: %s", err)
+			}
+
+			kept := []string{}
+			for _, message := range server.Messages(channel) {
+				kept = append(kept, message.Text)
+			}
+			if fmt.Sprint(kept) != fmt.Sprint(test.kept) {
+				t.Errorf("kept %v, want %v", kept, test.kept)
+			}
+
+			if response.Version["timestamp"] != parent {
+				t.Errorf("version = %v, want the deleted message", response.Version)
+			}
+			if len(response.Metadata) != 1 || response.Metadata[0].Name != "deleted" || response.Metadata[0].Value != parent {
+				t.Errorf("metadata = %v, want the deleted message", response.Metadata)
+			}
+		})
+	}
+}
+
+func TestPutReplacesMessage(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	transient := server.Post(channel, fakeslack.BotUserId, "Deploying...", "")
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "slack-out/timestamp", transient)
+
+	response, err := Put(out_request(t, `{"message": {"text": "Deployed"}, "delete_ts": "slack-out/timestamp"}`), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	messages := server.Messages(channel)
+	if len(messages) != 1 || messages[0].Text != "Deployed" {
+		t.Fatalf("messages = %v, want only the new message", messages)
+	}
+	if response.Version["timestamp"] != messages[0].Timestamp {
+		t.Errorf("version = %v, want the new message", response.Version)
+	}
+}
+
+func TestPutKeepsRequest(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.AddChannel("C00000002", "deployments", true)
+	ts := server.Post("C00000002", fakeslack.BotUserId, "Deploying 1.2.2", "")
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "version/number", "1.2.3")
+	write_file(t, source_dir, "slack-out/timestamp", ts)
+
+	request := out_request(t, `{"message": {"text": "Deploying {{version/number}}"}, "update_ts": "slack-out/timestamp"}`)
+	request.Source.ChannelId = ""
+	request.Source.ChannelName = "#deployments"
+	before, _ := json.Marshal(request)
+
+	if _, err := Put(request, source_dir, server.Client()); err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	if after, _ := json.Marshal(request); string(after) != string(before) {
+		t.Errorf("Put() changed the request:\n%s\nwant:\n%s", after, before)
+	}
+	if text := server.Message("C00000002", ts).Text; text != "Deploying 1.2.3" {
+		t.Errorf("updated %q, want %q", text, "Deploying 1.2.3")
+	}
+}
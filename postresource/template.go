@@ -0,0 +1,180 @@
+package postresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Concourse build metadata made available to templates, see
+// https://concourse-ci.org/implementing-resource-types.html#resource-metadata
+var concourse_variables = []string{
+	"BUILD_ID",
+	"BUILD_NAME",
+	"BUILD_JOB_NAME",
+	"BUILD_PIPELINE_NAME",
+	"BUILD_PIPELINE_INSTANCE_VARS",
+	"BUILD_TEAM_NAME",
+	"BUILD_CREATED_BY",
+	"ATC_EXTERNAL_URL",
+}
+
+// new_template_renderer returns an interpolator rendering text with
+// text/template, as selected by `params.template_engine: go`.
+func new_template_renderer(source_dir string) interpolator {
+	data := concourse_metadata()
+
+	funcs := template.FuncMap{
+		"file": func(pattern string) (string, error) {
+			return read_source_file(source_dir, pattern)
+		},
+		"env": os.Getenv,
+		"json": func(path string, field string) (string, error) {
+			return extract_field(source_dir, path, field, json.Unmarshal)
+		},
+		"yaml": func(path string, field string) (string, error) {
+			return extract_field(source_dir, path, field, yaml.Unmarshal)
+		},
+		"trim":     strings.TrimSpace,
+		"default":  default_value,
+		"truncate": truncate,
+	}
+
+	return func(text string) (string, error) {
+		tmpl, parse_err := template.New("message").Option("missingkey=error").Funcs(funcs).Parse(text)
+		if parse_err != nil {
+			return "", fmt.Errorf("parsing template: %w", parse_err)
+		}
+
+		var out strings.Builder
+		exec_err := tmpl.Execute(&out, data)
+		if exec_err != nil {
+			return "", fmt.Errorf("rendering template: %w", exec_err)
+		}
+
+		return out.String(), nil
+	}
+}
+
+func concourse_metadata() map[string]string {
+	data := map[string]string{}
+	for _, name := range concourse_variables {
+		data[name] = os.Getenv(name)
+	}
+
+	data["BUILD_URL"] = build_url(data)
+
+	return data
+}
+
+// build_url returns the web UI URL of the running build.
+func build_url(data map[string]string) string {
+	if len(data["ATC_EXTERNAL_URL"]) == 0 {
+		return ""
+	}
+
+	base := strings.TrimSuffix(data["ATC_EXTERNAL_URL"], "/")
+
+	// One-off builds do not belong to a job.
+	if len(data["BUILD_JOB_NAME"]) == 0 {
+		return base + "/builds/" + url.PathEscape(data["BUILD_ID"])
+	}
+
+	return base +
+		"/teams/" + url.PathEscape(data["BUILD_TEAM_NAME"]) +
+		"/pipelines/" + url.PathEscape(data["BUILD_PIPELINE_NAME"]) +
+		"/jobs/" + url.PathEscape(data["BUILD_JOB_NAME"]) +
+		"/builds/" + url.PathEscape(data["BUILD_NAME"])
+}
+
+// read_source_file returns the contents of the first file matching pattern
+// in the source directory.
+func read_source_file(source_dir string, pattern string) (string, error) {
+	matched, glob_err := filepath.Glob(filepath.Join(source_dir, pattern))
+	if glob_err != nil {
+		return "", glob_err
+	}
+	if len(matched) == 0 {
+		return "", fmt.Errorf("no file matched the pattern: %s", pattern)
+	}
+
+	data, read_err := os.ReadFile(matched[0])
+	if read_err != nil {
+		return "", read_err
+	}
+
+	return string(data), nil
+}
+
+// extract_field decodes a JSON or YAML file and returns the value found at the
+// dot-separated field path, e.g. "metadata.0.value". Missing fields are
+// empty, so that templates can give them a default value.
+func extract_field(source_dir string, path string, field string, unmarshal func([]byte, interface{}) error) (string, error) {
+	contents, read_err := read_source_file(source_dir, path)
+	if read_err != nil {
+		return "", read_err
+	}
+
+	var tree interface{}
+	decode_err := unmarshal([]byte(contents), &tree)
+	if decode_err != nil {
+		return "", fmt.Errorf("decoding %s: %w", path, decode_err)
+	}
+
+	value := tree
+	if len(field) > 0 {
+		for _, key := range strings.Split(field, ".") {
+			switch node := value.(type) {
+			case map[string]interface{}:
+				value = node[key]
+			case []interface{}:
+				index, index_err := strconv.Atoi(key)
+				if index_err != nil || index < 0 || index >= len(node) {
+					value = nil
+				} else {
+					value = node[index]
+				}
+			default:
+				value = nil
+			}
+		}
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	default:
+		data, encode_err := json.Marshal(value)
+		if encode_err != nil {
+			return "", encode_err
+		}
+		return string(data), nil
+	}
+}
+
+// default_value returns value, or fallback when value is empty.
+// Written to be used in pipelines: {{ env "TAG" | default "latest" }}
+func default_value(fallback interface{}, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return fallback
+	}
+	return value
+}
+
+// truncate shortens text to at most length characters.
+func truncate(length int, text string) string {
+	runes := []rune(text)
+	if length < 0 || len(runes) <= length {
+		return text
+	}
+	return string(runes[:length])
+}
@@ -0,0 +1,242 @@
+package postresource
+
+import (
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+	"github.com/slack-go/slack"
+)
+
+func TestBuildUrl(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]string
+		want string
+	}{
+		{
+			name: "job build",
+			data: map[string]string{
+				"ATC_EXTERNAL_URL":    "https://ci.example.com/",
+				"BUILD_TEAM_NAME":     "main",
+				"BUILD_PIPELINE_NAME": "release",
+				"BUILD_JOB_NAME":      "deploy",
+				"BUILD_NAME":          "42",
+				"BUILD_ID":            "1234",
+			},
+			want: "https://ci.example.com/teams/main/pipelines/release/jobs/deploy/builds/42",
+		},
+		{
+			name: "one-off build",
+			data: map[string]string{"ATC_EXTERNAL_URL": "https://ci.example.com", "BUILD_ID": "1234"},
+			want: "https://ci.example.com/builds/1234",
+		},
+		{
+			name: "escaped path",
+			data: map[string]string{
+				"ATC_EXTERNAL_URL":    "https://ci.example.com",
+				"BUILD_TEAM_NAME":     "my team",
+				"BUILD_PIPELINE_NAME": "a/b",
+				"BUILD_JOB_NAME":      "deploy?now",
+				"BUILD_NAME":          "42.1",
+			},
+			want: "https://ci.example.com/teams/my%20team/pipelines/a%2Fb/jobs/deploy%3Fnow/builds/42.1",
+		},
+		{
+			name: "no external URL",
+			data: map[string]string{"BUILD_JOB_NAME": "deploy"},
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := build_url(test.data); got != test.want {
+				t.Errorf("build_url() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTemplateRenderer(t *testing.T) {
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "version/version", "1.2.3\n")
+	write_file(t, source_dir, "release/info.json", `{"commit": {"author": "alice"}, "items": [{"name": "api"}, {"name": "web"}]}`)
+	write_file(t, source_dir, "release/info.yml", "commit:\n  author: bob\nitems:\n  - name: api\n  - name: web\n")
+	t.Setenv("ATC_EXTERNAL_URL", "https://ci.example.com")
+	t.Setenv("BUILD_ID", "1234")
+	t.Setenv("BUILD_JOB_NAME", "")
+	t.Setenv("TAG", "")
+
+	render := new_template_renderer(source_dir)
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`{{ .BUILD_URL }}`, "https://ci.example.com/builds/1234"},
+		{`{{ file "version/*" | trim }}`, "1.2.3"},
+		{`{{ env "TAG" | default "latest" }}`, "latest"},
+		{`{{ json "release/info.json" "commit.author" }}`, "alice"},
+		{`{{ json "release/info.json" "items.1.name" }}`, "web"},
+		{`{{ json "release/info.json" "items.0" }}`, `{"name":"api"}`},
+		{`{{ json "release/info.json" "items.2.name" | default "none" }}`, "none"},
+		{`{{ json "release/info.json" "items.x" | default "none" }}`, "none"},
+		{`{{ json "release/info.json" "commit.email" | default "unknown" }}`, "unknown"},
+		{`{{ json "release/info.json" "commit.author.name" | default "unknown" }}`, "unknown"},
+		{`{{ yaml "release/info.yml" "commit.author" }}`, "bob"},
+		{`{{ yaml "release/info.yml" "items.0.name" }}`, "api"},
+		{`{{ yaml "release/info.yml" "items.-1.name" | default "none" }}`, "none"},
+		{`{{ truncate 3 "héllo wörld" }}`, "hél"},
+		{`{{ truncate 2 "日本語" }}`, "日本"},
+		{`{{ truncate 10 "short" }}`, "short"},
+	}
+
+	for _, test := range tests {
+		got, err := render(test.text)
+		if err != nil {
+			t.Errorf("render(%s) failed: %s", test.text, err)
+		} else if got != test.want {
+			t.Errorf("render(%s) = %q, want %q", test.text, got, test.want)
+		}
+	}
+
+	failures := []string{
+		`{{ .NOT_A_VARIABLE }}`,
+		`{{ file "missing/file" }}`,
+		`{{ json "version/version" "x" }}`,
+		`{{ json "missing.json" "x" }}`,
+		`{{ unknown_function }}`,
+	}
+
+	for _, text := range failures {
+		if _, err := render(text); err == nil {
+			t.Errorf("render(%s) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	tests := []struct {
+		fallback interface{}
+		value    interface{}
+		want     interface{}
+	}{
+		{"latest", "", "latest"},
+		{"latest", nil, "latest"},
+		{"latest", "v1", "v1"},
+		{"latest", 0, 0},
+	}
+
+	for _, test := range tests {
+		if got := default_value(test.fallback, test.value); got != test.want {
+			t.Errorf("default_value(%v, %v) = %v, want %v", test.fallback, test.value, got, test.want)
+		}
+	}
+}
+
+func TestPutMessageFileTemplate(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "git/message", "Fix \"quoted\" bug\n\nDetails: a: b")
+	write_file(t, source_dir, "message.json", `{
+		"text": "{{ file `+"`git/message`"+` | trim }}",
+		"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": "by {{ env `+"`AUTHOR`"+` | default `+"`someone`"+` }}"}}]
+	}`)
+	write_file(t, source_dir, "message.yml", "text: '{{ file \"git/message\" | trim }}'\n")
+	t.Setenv("AUTHOR", "")
+
+	for _, file := range []string{"message.json", "message.yml"} {
+		t.Run(file, func(t *testing.T) {
+			request := out_request(t, `{"message_file": "`+file+`", "template_engine": "go"}`)
+
+			response, err := Put(request, source_dir, server.Client())
+			if err != nil {
+				t.Fatalf("Put() failed: %s", err)
+			}
+
+			posted := server.Message(channel, response.Version["timestamp"])
+			if posted == nil {
+				t.Fatalf("no message posted at %s", response.Version["timestamp"])
+			}
+
+			want := "Fix \"quoted\" bug\n\nDetails: a: b"
+			if posted.Text != want {
+				t.Errorf("posted %q, want %q", posted.Text, want)
+			}
+		})
+	}
+
+	posted := server.Messages(channel)[0]
+	if len(posted.Blocks.BlockSet) != 1 {
+		t.Fatalf("blocks = %v, want one section", posted.Blocks.BlockSet)
+	}
+	if text := posted.Blocks.BlockSet[0].(*slack.SectionBlock).Text.Text; text != "by someone" {
+		t.Errorf("block text = %q, want %q", text, "by someone")
+	}
+}
+
+func TestPutInterpolateMessageFile(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "version/number", "1.2.3")
+	write_file(t, source_dir, "message.json", `{
+		"text": "v{{version/number}} by {{$AUTHOR}}",
+		"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": "v{{version/number}}"}}],
+		"attachments": [{"text": "by {{$AUTHOR}}"}]
+	}`)
+	t.Setenv("AUTHOR", "alice")
+
+	tests := []struct {
+		name       string
+		params     string
+		text       string
+		block      string
+		attachment string
+	}{
+		{
+			name:       "default",
+			params:     `{"message_file": "message.json"}`,
+			text:       "v{{version/number}} by {{$AUTHOR}}",
+			block:      "v{{version/number}}",
+			attachment: "by {{$AUTHOR}}",
+		},
+		{
+			name:       "interpolate_message_file",
+			params:     `{"message_file": "message.json", "interpolate_message_file": true}`,
+			text:       "v1.2.3 by alice",
+			block:      "v1.2.3",
+			attachment: "by alice",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := Put(out_request(t, test.params), source_dir, server.Client())
+			if err != nil {
+				t.Fatalf("Put() failed: %s", err)
+			}
+
+			posted := server.Message(channel, response.Version["timestamp"])
+			if posted == nil {
+				t.Fatalf("no message posted at %s", response.Version["timestamp"])
+			}
+
+			if posted.Text != test.text {
+				t.Errorf("text = %q, want %q", posted.Text, test.text)
+			}
+			if len(posted.Blocks.BlockSet) != 1 {
+				t.Fatalf("blocks = %v, want one section", posted.Blocks.BlockSet)
+			}
+			if block := posted.Blocks.BlockSet[0].(*slack.SectionBlock).Text.Text; block != test.block {
+				t.Errorf("block text = %q, want %q", block, test.block)
+			}
+			if len(posted.Attachments) != 1 || posted.Attachments[0].Text != test.attachment {
+				t.Errorf("attachments = %+v, want one with text %q", posted.Attachments, test.attachment)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package postresource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// PutWebhook posts the message through the incoming webhook of
+// source.webhook_url. Webhooks can only post messages to their own channel,
+// and do not tell the timestamp of the posted message, so the version records
+// when it was sent.
+func PutWebhook(request *utils.OutRequest, source_dir string, http_client *http.Client) (utils.OutResponse, error) {
+
+	var response utils.OutResponse
+
+	request = request.Clone()
+
+	err := validate_webhook(request)
+	if err != nil {
+		return response, err
+	}
+
+	interpolate_text, err := new_interpolator(request.Params.TemplateEngine, source_dir)
+	if err != nil {
+		return response, err
+	}
+
+	message, err := read_request_message(request, source_dir, interpolate_text)
+	if err != nil {
+		return response, err
+	}
+
+	webhook_message := new_webhook_message(message)
+
+	fmt.Fprintf(utils.Log, "About to send this message through the webhook:\n")
+	m, _ := json.MarshalIndent(webhook_message, "", "  ")
+	fmt.Fprintf(utils.Log, "%s\n", m)
+
+	now := time.Now()
+
+	err = slack.PostWebhookCustomHTTP(request.Source.WebhookUrl, http_client, webhook_message)
+	if err != nil {
+		return response, fmt.Errorf("sending through webhook: %w", err)
+	}
+
+	response.Version = utils.Version{"timestamp": fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)}
+	response.Metadata = append(response.Metadata, utils.MetadataField{Name: "webhook", Value: "sent"})
+
+	return response, nil
+}
+
+// validate_webhook rejects the source and params fields that need the Web API.
+func validate_webhook(request *utils.OutRequest) error {
+
+	if len(request.Source.Token) > 0 || len(request.Source.TokenFile) > 0 || len(request.Source.TokenEnv) > 0 ||
+		len(request.Source.ChannelId) > 0 || len(request.Source.ChannelName) > 0 {
+		return errors.New("source field webhook_url cannot be used together with token, token_file, token_env, channel_id or channel_name")
+	}
+
+	if len(request.Params.MessageFile) == 0 && request.Params.Message == nil {
+		return errors.New("missing params field: message or message_file")
+	}
+
+	unsupported := []struct {
+		field string
+		given bool
+	}{
+		{"update_ts", len(request.Params.Ts) > 0},
+		{"emoji_reactions", len(request.Params.EmojiReactions) > 0},
+		{"thread_emoji_reactions", len(request.Params.ThreadEmojiReactions) > 0},
+		{"upload", request.Params.Upload != nil},
+		{"delete_ts", len(request.Params.DeleteTs) > 0},
+		{"cancel_scheduled", len(request.Params.CancelScheduled) > 0},
+		{"post_at", len(request.Params.PostAt) > 0},
+		{"ephemeral_user", len(request.Params.EphemeralUser) > 0},
+		{"channels", len(request.Params.Channels) > 0},
+		{"dm_users", len(request.Params.DmUsers) > 0},
+	}
+
+	for _, param := range unsupported {
+		if param.given {
+			return fmt.Errorf("params field %s needs a token and cannot be used with source field webhook_url", param.field)
+		}
+	}
+
+	return nil
+}
+
+// new_webhook_message returns the incoming webhook payload for the message.
+func new_webhook_message(message *utils.OutMessage) *slack.WebhookMessage {
+	webhook_message := &slack.WebhookMessage{
+		Text:            message.Text,
+		Attachments:     message.Attachments,
+		ThreadTimestamp: message.ThreadTimestamp,
+		Username:        message.Username,
+		IconEmoji:       message.IconEmoji,
+		IconURL:         message.IconURL,
+		Parse:           message.Parse,
+		ReplyBroadcast:  message.ReplyBroadcast,
+	}
+
+	if len(message.Blocks.BlockSet) > 0 {
+		webhook_message.Blocks = &message.Blocks
+	}
+
+	if message.UnfurlLinks {
+		webhook_message.UnfurlLinks = &message.UnfurlLinks
+	}
+
+	if message.UnfurlMedia {
+		webhook_message.UnfurlMedia = &message.UnfurlMedia
+	}
+
+	return webhook_message
+}
@@ -0,0 +1,101 @@
+package postresource
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+)
+
+func webhook_request(t *testing.T, server *fakeslack.Server, params string) *utils.OutRequest {
+	t.Helper()
+
+	request := out_request(t, params)
+	request.Source.ChannelId = ""
+	request.Source.WebhookUrl = server.WebhookURL()
+	return request
+}
+
+func TestPutWebhook(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	source_dir := t.TempDir()
+	write_file(t, source_dir, "version/number", "1.2.3")
+
+	request := webhook_request(t, server, `{
+		"message": {
+			"text": "Released {{version/number}}",
+			"thread_ts": "1700000001.000100",
+			"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": "*{{version/number}}*"}}]
+		}
+	}`)
+
+	response, err := PutWebhook(request, source_dir, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("PutWebhook() failed: %s", err)
+	}
+
+	if len(response.Version["timestamp"]) == 0 {
+		t.Errorf("version = %v, want a timestamp", response.Version)
+	}
+
+	webhooks := server.Webhooks()
+	if len(webhooks) != 1 {
+		t.Fatalf("posted %d webhook payloads, want 1", len(webhooks))
+	}
+
+	payload := webhooks[0]
+	if payload.Text != "Released 1.2.3" || payload.ThreadTimestamp != "1700000001.000100" {
+		t.Errorf("posted %q in thread %q, want %q in thread %q", payload.Text, payload.ThreadTimestamp, "Released 1.2.3", "1700000001.000100")
+	}
+	if payload.Blocks == nil || len(payload.Blocks.BlockSet) != 1 {
+		t.Errorf("posted blocks %v, want 1 block", payload.Blocks)
+	}
+}
+
+func TestPutWebhookErrors(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{name: "no message", params: `{}`},
+		{name: "update_ts", params: `{"message": {"text": "hi"}, "update_ts": "ts"}`},
+		{name: "emoji_reactions", params: `{"message": {"text": "hi"}, "emoji_reactions": ["rocket"]}`},
+		{name: "upload", params: `{"message": {"text": "hi"}, "upload": {"content": "x", "filename": "x.txt"}}`},
+		{name: "channels", params: `{"message": {"text": "hi"}, "channels": ["C2"]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := PutWebhook(webhook_request(t, server, test.params), t.TempDir(), http.DefaultClient)
+			if err == nil {
+				t.Errorf("PutWebhook(%s) succeeded, want an error", test.params)
+			}
+		})
+	}
+
+	t.Run("token", func(t *testing.T) {
+		request := webhook_request(t, server, `{"message": {"text": "hi"}}`)
+		request.Source.Token = "xoxb-token"
+		if _, err := PutWebhook(request, t.TempDir(), http.DefaultClient); err == nil {
+			t.Errorf("PutWebhook() with a token succeeded, want an error")
+		}
+	})
+
+	t.Run("webhook failure", func(t *testing.T) {
+		server.Fail("webhook", "invalid_blocks")
+		request := webhook_request(t, server, `{"message": {"text": "hi"}}`)
+		if _, err := PutWebhook(request, t.TempDir(), http.DefaultClient); err == nil {
+			t.Errorf("PutWebhook() succeeded while the webhook fails, want an error")
+		}
+	})
+
+	if len(server.Webhooks()) != 0 {
+		t.Errorf("posted %d webhook payloads, want none", len(server.Webhooks()))
+	}
+}
@@ -3,17 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 
-	//"strings"
+	"github.com/apptweak/concourse-slack-chat-resources/readresource"
 	"github.com/apptweak/concourse-slack-chat-resources/utils"
-	"github.com/slack-go/slack"
 )
 
-// FIMXE: Pass params to target resource
-
 func main() {
 	if len(os.Args) < 2 {
 		println("usage: " + os.Args[0] + " <destination>")
@@ -24,108 +19,33 @@ func main() {
 
 	var request utils.InRequest
 
-	var err error
-
-	err = json.NewDecoder(os.Stdin).Decode(&request)
+	err := json.NewDecoder(os.Stdin).Decode(&request)
 	if err != nil {
-		fatal("Parsing request.", err)
+		fatal("parsing request", err)
 	}
 
-	if len(request.Source.Token) == 0 {
-		fatal1("Missing source field: token.")
-	}
-
-	if len(request.Source.ChannelId) == 0 {
-		fatal1("Missing source field: channel_id.")
-	}
-
-	if _, ok := request.Version["timestamp"]; !ok {
-		fatal1("Missing version field: timestamp")
-	}
-
-	fmt.Fprintf(os.Stderr, "Request version: %v\n", request.Version["timestamp"])
-
-	slack_client := slack.New(request.Source.Token)
-
-	response := get(&request, destination, slack_client)
-
-	err = json.NewEncoder(os.Stdout).Encode(&response)
+	err = request.Source.ResolveToken()
 	if err != nil {
-		fatal("encoding response", err)
+		fatal("reading token", err)
 	}
-}
 
-func get(request *utils.InRequest, destination string, slack_client *slack.Client) utils.InResponse {
-
-	params := slack.GetConversationHistoryParameters{
-		ChannelID: request.Source.ChannelId,
+	slack_client, err := utils.NewSlackClient(&request.Source)
+	if err != nil {
+		fatal("configuring Slack client", err)
 	}
-	params.Latest = request.Version["timestamp"]
-	params.Inclusive = true
-	params.Limit = 1
 
-	history, err := slack_client.GetConversationHistory(&params)
+	response, err := readresource.Get(&request, destination, slack_client)
 	if err != nil {
 		fatal("getting message", err)
 	}
 
-	if len(history.Messages) < 1 {
-		fatal1("Message could not be found.")
-	}
-
-	message := history.Messages[0]
-
-	fmt.Fprintf(os.Stderr, "Text: %s\n", message.Msg.Text)
-
-	{
-		err := os.MkdirAll(destination, 0755)
-		if err != nil {
-			fatal("creating destination directory", err)
-		}
-	}
-
-	parts := []string{}
-
-	if request.Params.TextPattern != nil {
-		fmt.Fprintf(os.Stderr, "Pattern: %s\n", request.Params.TextPattern)
-		parts = request.Params.TextPattern.FindStringSubmatch(message.Msg.Text)
-	}
-
-	{
-		err := ioutil.WriteFile(filepath.Join(destination, "text"), []byte(message.Msg.Text), 0644)
-		if err != nil {
-			fatal("writing text file", err)
-		}
-	}
-
-	for i := 1; i < len(parts); i++ {
-		part := parts[i]
-		fmt.Fprintf(os.Stderr, "Part: %s\n", part)
-		filename := fmt.Sprintf("text_part%d", i)
-		err := ioutil.WriteFile(filepath.Join(destination, filename), []byte(part), 0644)
-		if err != nil {
-			fatal("writing text part file", err)
-		}
-	}
-
-	{
-		err := ioutil.WriteFile(filepath.Join(destination, "timestamp"), []byte(message.Msg.Timestamp), 0644)
-		if err != nil {
-			fatal("writing timestamp file", err)
-		}
+	err = json.NewEncoder(os.Stdout).Encode(&response)
+	if err != nil {
+		fatal("encoding response", err)
 	}
-
-	var response utils.InResponse
-	response.Version = request.Version
-	return response
 }
 
 func fatal(doing string, err error) {
-	fmt.Fprintf(os.Stderr, "error "+doing+": "+err.Error()+"\n")
-	os.Exit(1)
-}
-
-func fatal1(reason string) {
-	fmt.Fprintf(os.Stderr, reason+"\n")
+	fmt.Fprintf(utils.Log, "error %s: %s\n", doing, err)
 	os.Exit(1)
 }
@@ -1,10 +1,51 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+
+	"github.com/apptweak/concourse-slack-chat-resources/readresource"
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
 )
 
 func main() {
-	os.Stderr.WriteString("Not supported.\n")
+	if len(os.Args) < 2 {
+		println("usage: " + os.Args[0] + " <source>")
+		os.Exit(1)
+	}
+
+	source_dir := os.Args[1]
+
+	var request utils.ReactRequest
+
+	err := json.NewDecoder(os.Stdin).Decode(&request)
+	if err != nil {
+		fatal("parsing request", err)
+	}
+
+	err = request.Source.ResolveToken()
+	if err != nil {
+		fatal("reading token", err)
+	}
+
+	slack_client, err := utils.NewSlackClient(&request.Source)
+	if err != nil {
+		fatal("configuring Slack client", err)
+	}
+
+	response, err := readresource.Put(&request, source_dir, slack_client)
+	if err != nil {
+		fatal("acting on message", err)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(&response)
+	if err != nil {
+		fatal("encoding response", err)
+	}
+}
+
+func fatal(doing string, err error) {
+	fmt.Fprintf(utils.Log, "error %s: %s\n", doing, err)
 	os.Exit(1)
 }
@@ -0,0 +1,155 @@
+package readresource
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// resolve_filter looks up what the filter refers to by name, before messages
+// are matched: authors given by email, and the members of the usergroup.
+func resolve_filter(filter *utils.MessageFilter, slack_client Client) error {
+
+	if filter.BotOnly && filter.HumansOnly {
+		return errors.New("filter fields bot_only and humans_only cannot be used together")
+	}
+
+	cache := map[string]string{}
+
+	var err error
+
+	if len(filter.AuthorId) > 0 {
+		filter.AuthorId, err = resolve_author(filter.AuthorId, cache, slack_client)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range filter.Authors {
+		filter.Authors[i], err = resolve_author(filter.Authors[i], cache, slack_client)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range filter.NotAuthors {
+		filter.NotAuthors[i], err = resolve_author(filter.NotAuthors[i], cache, slack_client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(filter.Usergroup) > 0 {
+		usergroup_id, err := resolve_usergroup(filter.Usergroup, slack_client)
+		if err != nil {
+			return err
+		}
+
+		filter.UsergroupMembers, err = slack_client.GetUserGroupMembers(usergroup_id)
+		if err != nil {
+			return fmt.Errorf("listing members of usergroup %s: %w", filter.Usergroup, err)
+		}
+
+		fmt.Fprintf(utils.Log, "Usergroup %s has %d members.\n", filter.Usergroup, len(filter.UsergroupMembers))
+	}
+
+	return nil
+}
+
+// resolve_author returns the ID of an author given by user ID, bot ID or
+// email address.
+func resolve_author(author string, cache map[string]string, slack_client Client) (string, error) {
+	author = strings.TrimSpace(author)
+	if !strings.Contains(author, "@") {
+		return author, nil
+	}
+
+	if id, ok := cache[author]; ok {
+		return id, nil
+	}
+
+	user, err := slack_client.GetUserByEmail(author)
+	if err != nil {
+		return "", fmt.Errorf("looking up user %s: %w", author, err)
+	}
+
+	fmt.Fprintf(utils.Log, "User %s is %s\n", author, user.ID)
+	cache[author] = user.ID
+
+	return user.ID, nil
+}
+
+// resolve_usergroup returns the ID of a usergroup given by ID or handle,
+// e.g. @release-managers.
+func resolve_usergroup(usergroup string, slack_client Client) (string, error) {
+	usergroup = strings.TrimSpace(usergroup)
+	if !strings.HasPrefix(usergroup, "@") {
+		return usergroup, nil
+	}
+
+	handle := strings.TrimPrefix(usergroup, "@")
+
+	usergroups, err := slack_client.GetUserGroups()
+	if err != nil {
+		return "", fmt.Errorf("listing usergroups: %w", err)
+	}
+
+	for _, group := range usergroups {
+		if group.Handle == handle {
+			return group.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("usergroup %s not found", usergroup)
+}
+
+// match_author reports whether the author of the message is accepted by the
+// filter. Authors are compared to both the user and the bot ID of messages.
+func match_author(message *slack.Message, filter *utils.MessageFilter) bool {
+
+	is_bot := len(message.Msg.BotID) > 0 || message.Msg.SubType == slack.MsgSubTypeBotMessage
+
+	if filter.BotOnly && !is_bot {
+		fmt.Fprintf(utils.Log, "Author is not a bot.\n")
+		return false
+	}
+
+	if filter.HumansOnly && is_bot {
+		fmt.Fprintf(utils.Log, "Author is a bot.\n")
+		return false
+	}
+
+	if len(filter.AuthorId) > 0 && !is_author(message, []string{filter.AuthorId}) {
+		fmt.Fprintf(utils.Log, "Author is not %s.\n", filter.AuthorId)
+		return false
+	}
+
+	if len(filter.Authors) > 0 && !is_author(message, filter.Authors) {
+		fmt.Fprintf(utils.Log, "Author is not one of %s.\n", strings.Join(filter.Authors, ", "))
+		return false
+	}
+
+	if is_author(message, filter.NotAuthors) {
+		fmt.Fprintf(utils.Log, "Author is one of %s.\n", strings.Join(filter.NotAuthors, ", "))
+		return false
+	}
+
+	if len(filter.Usergroup) > 0 && !is_author(message, filter.UsergroupMembers) {
+		fmt.Fprintf(utils.Log, "Author is not a member of %s.\n", filter.Usergroup)
+		return false
+	}
+
+	return true
+}
+
+func is_author(message *slack.Message, ids []string) bool {
+	for _, id := range ids {
+		if message.Msg.User == id || (len(message.Msg.BotID) > 0 && message.Msg.BotID == id) {
+			return true
+		}
+	}
+	return false
+}
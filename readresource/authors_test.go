@@ -0,0 +1,91 @@
+package readresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+	"github.com/slack-go/slack"
+)
+
+func TestCheckAuthors(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.AddUser("U1", "alice@example.com")
+	server.AddUser("U2", "bob@example.com")
+	server.AddUsergroup("S1", "release-managers", "U2", "U3")
+
+	alice := server.Post(channel, "U1", "deploy", "")
+	bob := server.Post(channel, "U2", "deploy", "")
+	carol := server.Post(channel, "U3", "deploy", "")
+	bot := server.Add(channel, slack.Message{Msg: slack.Msg{BotID: "B1", SubType: "bot_message", Text: "deploy"}})
+
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{`{"matching": {"author": "bob@example.com"}}`, []string{bob}},
+		{`{"matching": {"authors": ["U1", "bob@example.com"]}}`, []string{alice, bob}},
+		{`{"matching": {"authors": ["B1"]}}`, []string{bot}},
+		{`{"matching": {"not_authors": ["alice@example.com", "B1"]}}`, []string{bob, carol}},
+		{`{"matching": {"usergroup": "S1"}}`, []string{bob, carol}},
+		{`{"matching": {"usergroup": "@release-managers", "not_authors": ["U3"]}}`, []string{bob}},
+		{`{"matching": {"bot_only": true}}`, []string{bot}},
+		{`{"matching": {"humans_only": true, "authors": ["U1", "U3", "B1"]}}`, []string{alice, carol}},
+	}
+
+	for _, test := range tests {
+		got := check_timestamps(t, server, test.source)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("Check(%s) = %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestCheckAuthorsErrors(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.Post(channel, "U1", "deploy", "")
+
+	tests := []string{
+		`{"matching": {"bot_only": true, "humans_only": true}}`,
+		`{"matching": {"authors": ["nobody@example.com"]}}`,
+		`{"matching": {"usergroup": "@missing"}}`,
+		`{"not_replied_by": {"usergroup": "S404"}}`,
+	}
+
+	for _, source := range tests {
+		if _, err := Check(check_request(t, source, `{}`), server.Client()); err == nil {
+			t.Errorf("Check(%s) succeeded, want an error", source)
+		}
+	}
+}
+
+func TestCheckKeepsRequest(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.AddChannel(channel, "deployments", true)
+	server.AddUser("U1", "alice@example.com")
+	server.AddUsergroup("S1", "release-managers", "U1")
+	server.Post(channel, "U1", "deploy", "")
+
+	request := check_request(t, `{
+		"channel_name": "#deployments",
+		"matching": {"authors": ["alice@example.com"], "usergroup": "@release-managers"},
+		"not_replied_by": {"author": "alice@example.com"}
+	}`, `{}`)
+	request.Source.ChannelId = ""
+	before, _ := json.Marshal(request)
+
+	if _, err := Check(request, server.Client()); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	if after, _ := json.Marshal(request); string(after) != string(before) {
+		t.Errorf("Check() changed the request:\n%s\nwant:\n%s", after, before)
+	}
+}
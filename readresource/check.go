@@ -0,0 +1,597 @@
+package readresource
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// Check returns the versions of the messages to trigger on, oldest first.
+func Check(request *utils.CheckRequest, slack_client Client) (utils.CheckResponse, error) {
+
+	request = request.Clone()
+
+	if len(request.Source.ChannelId) == 0 && len(request.Source.ChannelName) == 0 {
+		return nil, errors.New("missing source field: channel_id or channel_name")
+	}
+
+	if request.Source.Filter != nil {
+		log_filter("Filter", request.Source.Filter)
+	}
+
+	if request.Source.ReplyFilter != nil {
+		log_filter("Reply Filter", request.Source.ReplyFilter)
+	}
+
+	if len(request.Source.ThreadTs) > 0 {
+		fmt.Fprintf(utils.Log, "Thread: %s\n", request.Source.ThreadTs)
+	} else if request.Source.IncludeReplies {
+		fmt.Fprintf(utils.Log, "Including thread replies.\n")
+	}
+
+	if request.Source.IncludeEdits {
+		fmt.Fprintf(utils.Log, "Including edited messages.\n")
+	}
+
+	err := request.Source.ResolveChannelId(slack_client)
+	if err != nil {
+		return nil, fmt.Errorf("resolving channel: %w", err)
+	}
+
+	for _, filter := range []*utils.MessageFilter{request.Source.Filter, request.Source.ReplyFilter} {
+		if filter != nil {
+			err = resolve_filter(filter, slack_client)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	versions := []utils.Version{}
+	since := version_ts(request.Version)
+
+	// Messages matching the filter but for their reactions, which may be
+	// added later.
+	waiting_messages := []string{}
+
+	if len(request.Source.ThreadTs) > 0 {
+		replies, err := get_replies(request.Source.ThreadTs, request, slack_client)
+		if err != nil {
+			return nil, err
+		}
+		versions = process_replies(replies, request.Source.ThreadTs, request)
+	} else {
+		messages, err := get_messages(request, slack_client)
+		if err != nil {
+			return nil, err
+		}
+
+		pending := strings.Fields(request.Version["pending"])
+		stopped := false
+
+		for _, msg := range messages {
+
+			ts := message_ts(&msg, request)
+			is_current := msg.Msg.Timestamp == request.Version["timestamp"]
+			is_new := len(since) == 0 || !ts_less(ts, since)
+
+			// Other messages at the timestamp of the current version were
+			// reported before it: it was found late.
+			if is_new && ts == since && !is_current {
+				is_new = false
+			}
+
+			// Messages older than the current version are reported again
+			// if they were waiting for reactions that they now have.
+			is_late := !is_new && (slices.Contains(pending, msg.Msg.Timestamp) || is_current)
+
+			if !stopped && (is_new || is_late) {
+				status, err := process_message(&msg, request, slack_client)
+				if err != nil {
+					return nil, err
+				}
+
+				switch status {
+				case accepted:
+					version := message_version(&msg, request)
+					if is_late {
+						version["reacted"] = since
+					}
+					versions = append(versions, version)
+				case waiting:
+					waiting_messages = append(waiting_messages, msg.Msg.Timestamp)
+				case handled:
+					stopped = true
+				}
+			}
+
+			if request.Source.IncludeReplies && is_active_thread(&msg, since) {
+				replies, err := get_replies(msg.Msg.Timestamp, request, slack_client)
+				if err != nil {
+					return nil, err
+				}
+				versions = append(versions, process_replies(replies, msg.Msg.Timestamp, request)...)
+			} else if stopped {
+				break
+			}
+		}
+	}
+
+	for i, version := range versions {
+		if version["timestamp"] == request.Version["timestamp"] && version_ts(version) == since {
+			// The current version is reported as is.
+			versions[i] = request.Version
+			continue
+		}
+
+		if len(waiting_messages) > 0 {
+			err = add_pending(version, waiting_messages, request)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return version_less(versions[i], versions[j])
+	})
+
+	return utils.CheckResponse(versions), nil
+}
+
+// message_status tells what a check makes of a message.
+type message_status int
+
+const (
+	// The message does not match the filter.
+	skipped message_status = iota
+	// The message is reported as a version.
+	accepted
+	// The message matches the filter but for its reactions.
+	waiting
+	// The message was replied to as described by not_replied_by, so that
+	// it and older messages are handled.
+	handled
+)
+
+// add_pending lists in the version the messages waiting for reactions before
+// it, within source.thread_lookback: when the version is the current one,
+// the next check reports those that got their reactions.
+func add_pending(version utils.Version, waiting_messages []string, request *utils.CheckRequest) error {
+	lookback, err := thread_lookback(request)
+	if err != nil {
+		return err
+	}
+
+	until := version_ts(version)
+	oldest, err := ts_minus(until, lookback)
+	if err != nil {
+		return err
+	}
+
+	pending := []string{}
+	for _, ts := range waiting_messages {
+		if ts_less(ts, until) && !ts_less(ts, oldest) {
+			pending = append(pending, ts)
+		}
+	}
+
+	if len(pending) > 0 {
+		sort.Slice(pending, func(i, j int) bool { return ts_less(pending[i], pending[j]) })
+		version["pending"] = strings.Join(pending, " ")
+	}
+
+	return nil
+}
+
+// has_reaction_filter reports whether the filter matches reactions, which
+// may be added to messages after they were checked.
+func has_reaction_filter(filter *utils.MessageFilter) bool {
+	return filter != nil && (filter.HasReaction != nil || filter.NotReactedWith != nil)
+}
+
+// message_ts returns the timestamp ordering the message among versions: with
+// source.include_edits, the timestamp of its last edit, if any.
+func message_ts(message *slack.Message, request *utils.CheckRequest) string {
+	if request.Source.IncludeEdits && message.Msg.Edited != nil {
+		return message.Msg.Edited.Timestamp
+	}
+	return message.Msg.Timestamp
+}
+
+// message_version returns the version of a message. With
+// source.include_edits, each edit of a message makes a new version.
+func message_version(message *slack.Message, request *utils.CheckRequest) utils.Version {
+	version := utils.Version{"timestamp": message.Msg.Timestamp}
+	if request.Source.IncludeEdits && message.Msg.Edited != nil {
+		version["edited"] = message.Msg.Edited.Timestamp
+	}
+	return version
+}
+
+// version_ts returns the timestamp ordering the version: the timestamp of the
+// version after which a message was found to have its reactions, or of its
+// last edit, if any.
+func version_ts(version utils.Version) string {
+	if reacted, ok := version["reacted"]; ok {
+		return reacted
+	}
+	if edited, ok := version["edited"]; ok {
+		return edited
+	}
+	return version["timestamp"]
+}
+
+// version_less orders versions by version_ts. Messages found to have their
+// reactions after a version come after it, oldest first.
+func version_less(a utils.Version, b utils.Version) bool {
+	a_ts, b_ts := version_ts(a), version_ts(b)
+	if a_ts != b_ts {
+		return ts_less(a_ts, b_ts)
+	}
+
+	_, a_late := a["reacted"]
+	_, b_late := b["reacted"]
+	if a_late != b_late {
+		return b_late
+	}
+	return ts_less(a["timestamp"], b["timestamp"])
+}
+
+func log_filter(name string, filter *utils.MessageFilter) {
+	fmt.Fprintf(utils.Log, "%s:\n", name)
+	fmt.Fprintf(utils.Log, "  - author: %s\n", filter.AuthorId)
+	fmt.Fprintf(utils.Log, "  - pattern: %s\n", filter.TextPattern)
+	if len(filter.Authors) > 0 {
+		fmt.Fprintf(utils.Log, "  - authors: %s\n", strings.Join(filter.Authors, ", "))
+	}
+	if len(filter.NotAuthors) > 0 {
+		fmt.Fprintf(utils.Log, "  - not authors: %s\n", strings.Join(filter.NotAuthors, ", "))
+	}
+	if len(filter.Usergroup) > 0 {
+		fmt.Fprintf(utils.Log, "  - usergroup: %s\n", filter.Usergroup)
+	}
+	if filter.BotOnly {
+		fmt.Fprintf(utils.Log, "  - bots only\n")
+	}
+	if filter.HumansOnly {
+		fmt.Fprintf(utils.Log, "  - humans only\n")
+	}
+	if len(filter.Subtypes) > 0 {
+		fmt.Fprintf(utils.Log, "  - subtypes: %q\n", filter.Subtypes)
+	}
+	if len(filter.ExcludeSubtypes) > 0 {
+		fmt.Fprintf(utils.Log, "  - excluded subtypes: %q\n", filter.ExcludeSubtypes)
+	}
+	if filter.HasReaction != nil {
+		fmt.Fprintf(utils.Log, "  - has reaction: %s\n", filter.HasReaction)
+	}
+	if filter.NotReactedWith != nil {
+		fmt.Fprintf(utils.Log, "  - not reacted with: %s\n", filter.NotReactedWith)
+	}
+}
+
+// Number of messages requested per conversations.history page.
+const page_size = 500
+
+// Number of pages walked when source.max_pages is not set.
+const default_max_pages = 10
+
+func get_messages(request *utils.CheckRequest, slack_client Client) ([]slack.Message, error) {
+
+	params := slack.GetConversationHistoryParameters{
+		ChannelID: request.Source.ChannelId,
+	}
+
+	if request_version, ok := request.Version["timestamp"]; ok {
+		params.Oldest = request_version
+		fmt.Fprintf(utils.Log, "Request timestamp: %s\n", request_version)
+
+		// Replies may land in threads started before the current version,
+		// and messages may be edited or get reactions after it, so look
+		// back further.
+		if request.Source.IncludeReplies || request.Source.IncludeEdits || has_reaction_filter(request.Source.Filter) {
+			lookback, err := thread_lookback(request)
+			if err != nil {
+				return nil, err
+			}
+
+			params.Oldest, err = ts_minus(request_version, lookback)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(utils.Log, "Looking for threads, edits and reactions since: %s\n", params.Oldest)
+		}
+	}
+
+	params.Inclusive = true
+	params.Limit = page_size
+
+	max_pages := request.Source.MaxPages
+	if max_pages <= 0 {
+		max_pages = default_max_pages
+	}
+	max_messages := request.Source.MaxMessages
+
+	messages := []slack.Message{}
+
+	for page := 1; ; page++ {
+		history, err := slack_client.GetConversationHistory(&params)
+		if err != nil {
+			return nil, fmt.Errorf("getting messages: %w", err)
+		}
+
+		messages = append(messages, history.Messages...)
+
+		if max_messages > 0 && len(messages) >= max_messages {
+			if len(messages) > max_messages || history.HasMore {
+				fmt.Fprintf(utils.Log, "Reached max_messages (%d), older messages were not scanned.\n", max_messages)
+			}
+			messages = messages[:max_messages]
+			break
+		}
+
+		cursor := history.ResponseMetaData.NextCursor
+		if !history.HasMore || len(cursor) == 0 {
+			break
+		}
+
+		if page >= max_pages {
+			fmt.Fprintf(utils.Log, "Reached max_pages (%d), older messages were not scanned.\n", max_pages)
+			break
+		}
+
+		params.Cursor = cursor
+	}
+
+	fmt.Fprintf(utils.Log, "Scanned %d messages.\n", len(messages))
+
+	return messages, nil
+}
+
+func process_message(message *slack.Message, request *utils.CheckRequest,
+	slack_client Client) (message_status, error) {
+
+	is_reply := len(message.Msg.ThreadTimestamp) > 0 &&
+		message.Msg.ThreadTimestamp != message.Msg.Timestamp
+
+	if is_reply {
+		fmt.Fprintf(utils.Log, "Message %s is a reply. Skipping.\n", message.Msg.Timestamp)
+		return skipped, nil
+	}
+
+	fmt.Fprintf(utils.Log, "- Message %s: %s \n", message.Msg.Timestamp, message.Msg.Text)
+
+	if request.Source.Filter != nil {
+		fmt.Fprintf(utils.Log, "Matching message...\n")
+		if !match_fields(message, request.Source.Filter) {
+			fmt.Fprintf(utils.Log, "Message did not matched.\n")
+			return skipped, nil
+		}
+		if !match_reactions(message, request.Source.Filter) {
+			fmt.Fprintf(utils.Log, "Message is waiting for reactions.\n")
+			return waiting, nil
+		}
+		fmt.Fprintf(utils.Log, "Message matched.\n")
+	}
+
+	if request.Source.ReplyFilter != nil {
+		fmt.Fprintf(utils.Log, "Matching replies...\n")
+		matched, err := match_replies(message, request, slack_client)
+		if err != nil {
+			return skipped, err
+		}
+		if matched {
+			fmt.Fprintf(utils.Log, "A reply was matched.\n")
+			return handled, nil
+		}
+	}
+
+	return accepted, nil
+}
+
+func match_message(message *slack.Message, filter *utils.MessageFilter) bool {
+
+	if !match_fields(message, filter) || !match_reactions(message, filter) {
+		return false
+	}
+
+	fmt.Fprintf(utils.Log, "Message matched.\n")
+
+	return true
+}
+
+// match_fields reports whether the author, subtype and text of the message
+// match the filter.
+func match_fields(message *slack.Message, filter *utils.MessageFilter) bool {
+
+	if !match_author(message, filter) {
+		return false
+	}
+
+	if len(filter.Subtypes) > 0 && !slices.Contains(filter.Subtypes, message.Msg.SubType) {
+		fmt.Fprintf(utils.Log, "Message subtype %q is not one of %q.\n", message.Msg.SubType, filter.Subtypes)
+		return false
+	}
+
+	if slices.Contains(filter.ExcludeSubtypes, message.Msg.SubType) {
+		fmt.Fprintf(utils.Log, "Message subtype %q is excluded.\n", message.Msg.SubType)
+		return false
+	}
+
+	text_pattern := filter.TextPattern
+	if text_pattern != nil && !text_pattern.MatchString(message.Msg.Text) {
+		fmt.Fprintf(utils.Log, "Message text does not match pattern.\n")
+		return false
+	}
+
+	return true
+}
+
+// match_reactions reports whether the reactions of the message match the
+// filter.
+func match_reactions(message *slack.Message, filter *utils.MessageFilter) bool {
+
+	if filter.HasReaction != nil && !filter.HasReaction.Match(message.Msg.Reactions) {
+		fmt.Fprintf(utils.Log, "Message has no reaction %s.\n", filter.HasReaction)
+		return false
+	}
+
+	if filter.NotReactedWith != nil && filter.NotReactedWith.Match(message.Msg.Reactions) {
+		fmt.Fprintf(utils.Log, "Message has a reaction %s.\n", filter.NotReactedWith)
+		return false
+	}
+
+	return true
+}
+
+func match_replies(message *slack.Message, request *utils.CheckRequest, slack_client Client) (bool, error) {
+
+	if message.Msg.ReplyCount == 0 {
+		return false, nil
+	}
+
+	replies, err := get_replies(message.Msg.Timestamp, request, slack_client)
+	if err != nil {
+		return false, err
+	}
+
+	for _, reply := range replies {
+		if reply.Msg.Timestamp == message.Msg.Timestamp {
+			continue
+		}
+		fmt.Fprintf(utils.Log, "- A reply: %s\n", reply.Msg.Text)
+		if match_message(&reply, request.Source.ReplyFilter) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Default for source.thread_lookback.
+const default_thread_lookback = 24 * time.Hour
+
+func thread_lookback(request *utils.CheckRequest) (time.Duration, error) {
+	if len(request.Source.ThreadLookback) == 0 {
+		return default_thread_lookback, nil
+	}
+
+	lookback, err := time.ParseDuration(request.Source.ThreadLookback)
+	if err != nil {
+		return 0, fmt.Errorf("parsing source field thread_lookback: %w", err)
+	}
+
+	return lookback, nil
+}
+
+// is_active_thread reports whether the message starts a thread that received
+// replies at or after the given timestamp.
+func is_active_thread(message *slack.Message, since string) bool {
+	if message.Msg.ReplyCount == 0 {
+		return false
+	}
+
+	return len(since) == 0 || !ts_less(message.Msg.LatestReply, since)
+}
+
+func get_replies(thread_ts string, request *utils.CheckRequest, slack_client Client) ([]slack.Message, error) {
+
+	params := slack.GetConversationRepliesParameters{
+		ChannelID: request.Source.ChannelId,
+		Timestamp: thread_ts,
+		Limit:     page_size,
+	}
+
+	replies := []slack.Message{}
+
+	for {
+		page, has_more, cursor, err := slack_client.GetConversationReplies(&params)
+		if err != nil {
+			return nil, fmt.Errorf("getting replies: %w", err)
+		}
+
+		replies = append(replies, page...)
+
+		if !has_more || len(cursor) == 0 {
+			break
+		}
+
+		params.Cursor = cursor
+	}
+
+	return replies, nil
+}
+
+// process_replies returns the versions of thread replies matching the
+// `matching` filter. Replies older than one matching `not_replied_by` are
+// considered handled, just like top-level messages.
+func process_replies(replies []slack.Message, thread_ts string, request *utils.CheckRequest) []utils.Version {
+
+	since := version_ts(request.Version)
+	versions := []utils.Version{}
+
+	for i := len(replies) - 1; i >= 0; i-- {
+		reply := &replies[i]
+
+		if reply.Msg.Timestamp == thread_ts {
+			continue
+		}
+
+		fmt.Fprintf(utils.Log, "- Reply %s in thread %s: %s \n", reply.Msg.Timestamp, thread_ts, reply.Msg.Text)
+
+		if request.Source.ReplyFilter != nil && match_message(reply, request.Source.ReplyFilter) {
+			fmt.Fprintf(utils.Log, "Reply matched not_replied_by, older replies are handled.\n")
+			break
+		}
+
+		if len(since) > 0 && ts_less(message_ts(reply, request), since) {
+			// Older replies may still have been edited since.
+			if request.Source.IncludeEdits {
+				continue
+			}
+			break
+		}
+
+		if request.Source.Filter != nil && !match_message(reply, request.Source.Filter) {
+			continue
+		}
+
+		version := message_version(reply, request)
+		version["thread_ts"] = thread_ts
+		versions = append(versions, version)
+	}
+
+	return versions
+}
+
+// ts_less reports whether Slack timestamp a is older than b.
+func ts_less(a string, b string) bool {
+	a_sec, a_frac, _ := strings.Cut(a, ".")
+	b_sec, b_frac, _ := strings.Cut(b, ".")
+
+	if len(a_sec) != len(b_sec) {
+		return len(a_sec) < len(b_sec)
+	}
+	if a_sec != b_sec {
+		return a_sec < b_sec
+	}
+	return a_frac < b_frac
+}
+
+// ts_minus returns the Slack timestamp that is the given duration before ts.
+func ts_minus(ts string, d time.Duration) (string, error) {
+	seconds, err := strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return "", fmt.Errorf("parsing timestamp %s: %w", ts, err)
+	}
+
+	return strconv.FormatFloat(seconds-d.Seconds(), 'f', 6, 64), nil
+}
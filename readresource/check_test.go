@@ -0,0 +1,413 @@
+package readresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+const channel = "C00000001"
+
+func check_request(t *testing.T, source string, version string) *utils.CheckRequest {
+	t.Helper()
+
+	var request utils.CheckRequest
+	payload := fmt.Sprintf(`{"source": %s, "version": %s}`, source, version)
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		t.Fatalf("parsing request: %s", err)
+	}
+	request.Source.ChannelId = channel
+	return &request
+}
+
+// check_timestamps runs a check with the source and no version, and returns
+// the timestamps of the versions found.
+func check_timestamps(t *testing.T, server *fakeslack.Server, source string) []string {
+	t.Helper()
+
+	response, err := Check(check_request(t, source, `{}`), server.Client())
+	if err != nil {
+		t.Fatalf("Check(%s) failed: %s", source, err)
+	}
+
+	timestamps := []string{}
+	for _, version := range response {
+		timestamps = append(timestamps, version["timestamp"])
+	}
+	return timestamps
+}
+
+func TestCheck(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.AddChannel(channel, "deploys", true)
+	first := server.Post(channel, "U1", "deploy v1", "")
+	server.Post(channel, "U1", "hello", "")
+	second := server.Post(channel, "U1", "deploy v2", "")
+
+	request := check_request(t, `{"channel_name": "#deploys", "matching": {"text_pattern": "^deploy"}}`, `{}`)
+	request.Source.ChannelId = ""
+
+	response, err := Check(request, server.Client())
+	if err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	want := fmt.Sprint(utils.CheckResponse{{"timestamp": first}, {"timestamp": second}})
+	if fmt.Sprint(response) != want {
+		t.Errorf("Check() = %v, want %v", response, want)
+	}
+}
+
+func TestCheckReactions(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	pending := server.Post(channel, "U1", "release v1", "")
+	approved := server.Post(channel, "U1", "release v2", "")
+	server.React(channel, approved, "U2", "white_check_mark")
+	rejected := server.Post(channel, "U1", "release v3", "")
+	server.React(channel, rejected, "U2", "white_check_mark")
+	server.React(channel, rejected, "U3", "x")
+	self_approved := server.Post(channel, "U1", "release v4", "")
+	server.React(channel, self_approved, "U1", "white_check_mark")
+	thumbs := server.Post(channel, "U1", "release v5", "")
+	server.React(channel, thumbs, "U2", "+1::skin-tone-3")
+
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{`{"matching": {"has_reaction": ":white_check_mark:"}}`, []string{approved, rejected, self_approved}},
+		{`{"matching": {"has_reaction": ["white_check_mark", "+1"], "not_reacted_with": "x"}}`, []string{approved, self_approved, thumbs}},
+		{`{"matching": {"has_reaction": {"names": ["white_check_mark"], "users": ["U2", "U3"]}}}`, []string{approved, rejected}},
+		{`{"matching": {"not_reacted_with": ["white_check_mark", "x"]}}`, []string{pending, thumbs}},
+	}
+
+	for _, test := range tests {
+		got := check_timestamps(t, server, test.source)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("Check(%s) = %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestCheckLateReactions(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	source := `{"matching": {"text_pattern": "^release", "has_reaction": "white_check_mark"}}`
+	check := func(version utils.Version) utils.CheckResponse {
+		t.Helper()
+
+		data, _ := json.Marshal(version)
+		response, err := Check(check_request(t, source, string(data)), server.Client())
+		if err != nil {
+			t.Fatalf("Check(%v) failed: %s", version, err)
+		}
+		return response
+	}
+
+	r0 := server.Post(channel, "U1", "release v0", "")
+	server.React(channel, r0, "U2", "white_check_mark")
+	r1 := server.Post(channel, "U1", "release v1", "")
+	r2 := server.Post(channel, "U1", "release v2", "")
+	server.React(channel, r2, "U2", "white_check_mark")
+	server.Post(channel, "U1", "hello", "")
+
+	// R2 is approved before R1: R1 is listed as pending in the version of R2.
+	response := check(utils.Version{})
+	want := utils.CheckResponse{{"timestamp": r0}, {"timestamp": r2, "pending": r1}}
+	if fmt.Sprint(response) != fmt.Sprint(want) {
+		t.Fatalf("Check() = %v, want %v", response, want)
+	}
+	current := response[len(response)-1]
+
+	if fmt.Sprint(check(current)) != fmt.Sprint(utils.CheckResponse{current}) {
+		t.Errorf("Check(%v) = %v, want only the current version", current, check(current))
+	}
+
+	// Once approved, R1 comes after R2, and R0 is not reported again.
+	server.React(channel, r1, "U2", "white_check_mark")
+
+	response = check(current)
+	want = utils.CheckResponse{current, {"timestamp": r1, "reacted": r2}}
+	if fmt.Sprint(response) != fmt.Sprint(want) {
+		t.Fatalf("Check(%v) = %v, want %v", current, response, want)
+	}
+	current = response[len(response)-1]
+
+	if fmt.Sprint(check(current)) != fmt.Sprint(utils.CheckResponse{current}) {
+		t.Errorf("Check(%v) = %v, want only the current version", current, check(current))
+	}
+
+	r3 := server.Post(channel, "U1", "release v3", "")
+	server.React(channel, r3, "U2", "white_check_mark")
+
+	response = check(current)
+	want = utils.CheckResponse{current, {"timestamp": r3}}
+	if fmt.Sprint(response) != fmt.Sprint(want) {
+		t.Errorf("Check(%v) = %v, want %v", current, response, want)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	request := check_request(t, `{}`, `{}`)
+	request.Source.ChannelId = ""
+	if _, err := Check(request, server.Client()); err == nil {
+		t.Errorf("Check() without channel succeeded, want an error")
+	}
+
+	server.Fail("conversations.history", "channel_not_found")
+	if _, err := Check(check_request(t, `{}`, `{}`), server.Client()); err == nil {
+		t.Errorf("Check() succeeded while Slack fails, want an error")
+	}
+}
+
+func TestProcessMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		text       string
+		author     string
+		reply_from string
+		reply      bool
+		status     message_status
+	}{
+		{name: "no filter", source: `{}`, text: "hello", author: "U1", status: accepted},
+		{name: "reply", source: `{}`, text: "hello", author: "U1", reply: true, status: skipped},
+		{name: "author matches", source: `{"matching": {"author": "U1"}}`, text: "hello", author: "U1", status: accepted},
+		{name: "author differs", source: `{"matching": {"author": "U2"}}`, text: "hello", author: "U1", status: skipped},
+		{name: "pattern matches", source: `{"matching": {"text_pattern": "^deploy (\\w+)"}}`, text: "Deploy prod", author: "U1", status: accepted},
+		{name: "pattern differs", source: `{"matching": {"text_pattern": "^deploy"}}`, text: "hello", author: "U1", status: skipped},
+		{name: "missing reaction", source: `{"matching": {"text_pattern": "^deploy", "has_reaction": "white_check_mark"}}`, text: "deploy", author: "U1", status: waiting},
+		{name: "missing reaction and pattern differs", source: `{"matching": {"text_pattern": "^deploy", "has_reaction": "white_check_mark"}}`, text: "hello", author: "U1", status: skipped},
+		{name: "replied by filter", source: `{"not_replied_by": {"author": "UBOT"}}`, text: "deploy", author: "U1", reply_from: "UBOT", status: handled},
+		{name: "replied by other", source: `{"not_replied_by": {"author": "UBOT"}}`, text: "deploy", author: "U1", reply_from: "U2", status: accepted},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakeslack.New()
+			defer server.Close()
+
+			ts := server.Post(channel, test.author, test.text, "")
+			if test.reply_from != "" {
+				server.Post(channel, test.reply_from, "on it", ts)
+			}
+			if test.reply {
+				ts = server.Post(channel, test.author, test.text, ts)
+			}
+
+			request := check_request(t, test.source, `{}`)
+			messages, err := get_replies(ts, request, server.Client())
+			if err != nil {
+				t.Fatalf("get_replies() failed: %s", err)
+			}
+			message := messages[len(messages)-1]
+			if !test.reply {
+				message = messages[0]
+			}
+
+			status, err := process_message(&message, request, server.Client())
+			if err != nil {
+				t.Fatalf("process_message() failed: %s", err)
+			}
+			if status != test.status {
+				t.Errorf("process_message() = %v, want %v", status, test.status)
+			}
+		})
+	}
+}
+
+func TestMatchReplies(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	lonely := server.Post(channel, "U1", "deploy", "")
+	answered := server.Post(channel, "U1", "deploy", "")
+	server.Post(channel, "U2", "me too", answered)
+	server.Post(channel, "UBOT", "done", answered)
+
+	request := check_request(t, `{"not_replied_by": {"author": "UBOT", "text_pattern": "done"}}`, `{}`)
+
+	for ts, want := range map[string]bool{lonely: false, answered: true} {
+		replies, err := get_replies(ts, request, server.Client())
+		if err != nil {
+			t.Fatalf("get_replies() failed: %s", err)
+		}
+		got, err := match_replies(&replies[0], request, server.Client())
+		if err != nil {
+			t.Fatalf("match_replies() failed: %s", err)
+		}
+		if got != want {
+			t.Errorf("match_replies(%s) = %v, want %v", ts, got, want)
+		}
+	}
+}
+
+func TestGetMessagesPaginates(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	for i := 0; i < 2*page_size+10; i++ {
+		server.Post(channel, "U1", fmt.Sprintf("message %d", i), "")
+	}
+
+	tests := []struct {
+		source string
+		want   int
+	}{
+		{source: `{}`, want: 2*page_size + 10},
+		{source: `{"max_pages": 2}`, want: 2 * page_size},
+		{source: `{"max_messages": 600}`, want: 600},
+	}
+
+	for _, test := range tests {
+		messages, err := get_messages(check_request(t, test.source, `{}`), server.Client())
+		if err != nil {
+			t.Fatalf("get_messages(%s) failed: %s", test.source, err)
+		}
+		if len(messages) != test.want {
+			t.Errorf("get_messages(%s) returned %d messages, want %d", test.source, len(messages), test.want)
+		}
+		if messages[0].Text != fmt.Sprintf("message %d", 2*page_size+9) {
+			t.Errorf("get_messages(%s) starts with %q, want the newest message", test.source, messages[0].Text)
+		}
+	}
+}
+
+func TestProcessReplies(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	parent := server.Post(channel, "U1", "release thread", "")
+	server.Post(channel, "U1", "@bot deploy v1", parent)
+	server.Post(channel, "UBOT", "deployed v1", parent)
+	since := server.Post(channel, "U1", "@bot deploy v2", parent)
+	server.Post(channel, "U2", "thanks", parent)
+	latest := server.Post(channel, "U1", "@bot deploy v3", parent)
+
+	source := `{"matching": {"text_pattern": "@bot deploy"}, "not_replied_by": {"author": "UBOT"}}`
+	replies, err := get_replies(parent, check_request(t, source, `{}`), server.Client())
+	if err != nil {
+		t.Fatalf("get_replies() failed: %s", err)
+	}
+
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{version: `{}`, want: []string{latest, since}},
+		{version: fmt.Sprintf(`{"timestamp": %q}`, latest), want: []string{latest}},
+	}
+
+	for _, test := range tests {
+		versions := process_replies(replies, parent, check_request(t, source, test.version))
+
+		got := []string{}
+		for _, version := range versions {
+			if version["thread_ts"] != parent {
+				t.Errorf("version %v has thread_ts %s, want %s", version, version["thread_ts"], parent)
+			}
+			got = append(got, version["timestamp"])
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("process_replies(version %s) = %v, want %v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestTsLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1700000000.000100", "1700000000.000200", true},
+		{"1700000000.000200", "1700000000.000100", false},
+		{"999999999.000100", "1700000000.000100", true},
+		{"1700000000.000100", "1700000000.000100", false},
+	}
+
+	for _, test := range tests {
+		if got := ts_less(test.a, test.b); got != test.want {
+			t.Errorf("ts_less(%s, %s) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestCheckSubtypes(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	plain := server.Post(channel, "U1", "deploy", "")
+	joined := server.Add(channel, slack.Message{Msg: slack.Msg{User: "U2", SubType: "channel_join", Text: "joined"}})
+	shared := server.Add(channel, slack.Message{Msg: slack.Msg{User: "U1", SubType: "file_share", Text: "deploy.log"}})
+
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{`{"matching": {"subtypes": ["file_share"]}}`, []string{shared}},
+		{`{"matching": {"subtypes": ["", "file_share"]}}`, []string{plain, shared}},
+		{`{"matching": {"exclude_subtypes": ["channel_join"]}}`, []string{plain, shared}},
+		{`{"matching": {}}`, []string{plain, joined, shared}},
+	}
+
+	for _, test := range tests {
+		got := check_timestamps(t, server, test.source)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("Check(%s) = %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestCheckEdits(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	first := server.Post(channel, "U1", "deploy v1", "")
+	second := server.Post(channel, "U1", "deploy v2", "")
+	edited := server.Edit(channel, first, "deploy v1.1")
+
+	response, err := Check(check_request(t, `{"include_edits": true}`, `{"timestamp": "`+second+`"}`), server.Client())
+	if err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	want := []utils.Version{
+		{"timestamp": second},
+		{"timestamp": first, "edited": edited},
+	}
+	if fmt.Sprint(response) != fmt.Sprint(want) {
+		t.Errorf("Check() = %v, want %v", response, want)
+	}
+
+	response, err = Check(check_request(t, `{"include_edits": true}`, `{"timestamp": "`+first+`", "edited": "`+edited+`"}`), server.Client())
+	if err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	want = []utils.Version{{"timestamp": first, "edited": edited}}
+	if fmt.Sprint(response) != fmt.Sprint(want) {
+		t.Errorf("Check() = %v, want %v", response, want)
+	}
+
+	response, err = Check(check_request(t, `{}`, `{"timestamp": "`+second+`"}`), server.Client())
+	if err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	want = []utils.Version{{"timestamp": second}}
+	if fmt.Sprint(response) != fmt.Sprint(want) {
+		t.Errorf("Check() without include_edits = %v, want %v", response, want)
+	}
+}
@@ -0,0 +1,24 @@
+// Package readresource implements the Slack read resource: finding messages
+// to trigger on (check), fetching them (get) and acting on them (put).
+package readresource
+
+import (
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// Client is the part of the Slack API used by the read resource, implemented
+// by *slack.Client.
+type Client interface {
+	utils.ChannelLister
+	GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	GetConversationReplies(params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error)
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	AddReaction(name string, item slack.ItemRef) error
+	RemoveReaction(name string, item slack.ItemRef) error
+	GetPermalink(params *slack.PermalinkParameters) (string, error)
+	GetUserByEmail(email string) (*slack.User, error)
+	GetUserInfo(user string) (*slack.User, error)
+	GetUserGroups(options ...slack.GetUserGroupsOption) ([]slack.UserGroup, error)
+	GetUserGroupMembers(userGroup string, options ...slack.GetUserGroupMembersOption) ([]string, error)
+}
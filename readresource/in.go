@@ -0,0 +1,280 @@
+package readresource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// Get fetches the message of the requested version and writes it, its text,
+// pattern matches, author, link and timestamps to files in the destination
+// directory.
+func Get(request *utils.InRequest, destination string, slack_client Client) (utils.InResponse, error) {
+
+	var response utils.InResponse
+
+	request = request.Clone()
+
+	if len(request.Source.ChannelId) == 0 && len(request.Source.ChannelName) == 0 {
+		return response, errors.New("missing source field: channel_id or channel_name")
+	}
+
+	if _, ok := request.Version["timestamp"]; !ok {
+		return response, errors.New("missing version field: timestamp")
+	}
+
+	fmt.Fprintf(utils.Log, "Request version: %v\n", request.Version["timestamp"])
+	if thread_ts, ok := request.Version["thread_ts"]; ok {
+		fmt.Fprintf(utils.Log, "Request thread: %v\n", thread_ts)
+	}
+
+	err := request.Source.ResolveChannelId(slack_client)
+	if err != nil {
+		return response, fmt.Errorf("resolving channel: %w", err)
+	}
+
+	message, err := get_message(request, slack_client)
+	if err != nil {
+		return response, err
+	}
+
+	fmt.Fprintf(utils.Log, "Text: %s\n", message.Msg.Text)
+
+	err = os.MkdirAll(destination, 0755)
+	if err != nil {
+		return response, fmt.Errorf("creating destination directory: %w", err)
+	}
+
+	err = write_file(destination, "text", message.Msg.Text)
+	if err != nil {
+		return response, err
+	}
+
+	if len(request.Params.TextPattern) > 0 {
+		err = write_captures(destination, request.Params.TextPattern, message.Msg.Text)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	err = write_file(destination, "timestamp", message.Msg.Timestamp)
+	if err != nil {
+		return response, err
+	}
+
+	// Messages that do not belong to a thread start their own.
+	thread_ts := message.Msg.ThreadTimestamp
+	if len(thread_ts) == 0 {
+		thread_ts = message.Msg.Timestamp
+	}
+
+	err = write_file(destination, "thread_ts", thread_ts)
+	if err != nil {
+		return response, err
+	}
+
+	err = write_file(destination, "reply_count", strconv.Itoa(message.Msg.ReplyCount))
+	if err != nil {
+		return response, err
+	}
+
+	err = write_author(destination, &message, slack_client)
+	if err != nil {
+		return response, err
+	}
+
+	err = write_permalink(destination, &message, request, slack_client)
+	if err != nil {
+		return response, err
+	}
+
+	data, err := json.MarshalIndent(message, "", "  ")
+	if err != nil {
+		return response, fmt.Errorf("encoding message: %w", err)
+	}
+
+	err = write_file(destination, "message.json", string(data))
+	if err != nil {
+		return response, err
+	}
+
+	// A put of the read resource returns this version as is, so that it is
+	// one the check reports.
+	data, err = json.Marshal(request.Version)
+	if err != nil {
+		return response, fmt.Errorf("encoding version: %w", err)
+	}
+
+	err = write_file(destination, "version.json", string(data))
+	if err != nil {
+		return response, err
+	}
+
+	response.Version = request.Version
+	return response, nil
+}
+
+// write_captures matches the text against the patterns in order, and writes
+// the groups captured by the first matching one: each group to text_part<num>
+// and, if named, to text_<name>, and all of them to captures.json, keyed by
+// name or by index for unnamed groups.
+func write_captures(destination string, patterns utils.Regexps, text string) error {
+
+	captures := map[string]string{}
+
+	for _, pattern := range patterns {
+		fmt.Fprintf(utils.Log, "Pattern: %s\n", pattern)
+
+		parts := pattern.FindStringSubmatch(text)
+		if parts == nil {
+			continue
+		}
+
+		names := pattern.SubexpNames()
+
+		for i := 1; i < len(parts); i++ {
+			part := parts[i]
+			fmt.Fprintf(utils.Log, "Part: %s\n", part)
+			err := write_file(destination, fmt.Sprintf("text_part%d", i), part)
+			if err != nil {
+				return err
+			}
+
+			if len(names[i]) == 0 {
+				captures[strconv.Itoa(i)] = part
+				continue
+			}
+
+			captures[names[i]] = part
+			err = write_file(destination, "text_"+names[i], part)
+			if err != nil {
+				return err
+			}
+		}
+
+		break
+	}
+
+	if len(captures) == 0 {
+		fmt.Fprintf(utils.Log, "No pattern captured any text.\n")
+	}
+
+	data, err := json.Marshal(captures)
+	if err != nil {
+		return fmt.Errorf("encoding captures: %w", err)
+	}
+
+	return write_file(destination, "captures.json", string(data))
+}
+
+// write_author writes the ID and name of the message author: a user, or a bot
+// for messages posted without one. Names need the users:read scope, so the
+// user_name file is only written if the user can be looked up.
+func write_author(destination string, message *slack.Message, slack_client Client) error {
+
+	user := message.Msg.User
+	name := message.Msg.Username
+
+	if len(user) > 0 {
+		info, err := slack_client.GetUserInfo(user)
+		if err != nil {
+			fmt.Fprintf(utils.Log, "Could not look up user %s: %s\n", user, err)
+		} else {
+			name = info.Name
+		}
+	} else {
+		user = message.Msg.BotID
+	}
+
+	fmt.Fprintf(utils.Log, "Author: %s %s\n", user, name)
+
+	err := write_file(destination, "user", user)
+	if err != nil {
+		return err
+	}
+
+	if len(name) == 0 {
+		return nil
+	}
+
+	return write_file(destination, "user_name", name)
+}
+
+// write_permalink writes the link to the message. Like user_name, it is a
+// convenience, so the permalink file is only written if Slack returns one.
+func write_permalink(destination string, message *slack.Message, request *utils.InRequest, slack_client Client) error {
+
+	permalink, err := slack_client.GetPermalink(&slack.PermalinkParameters{
+		Channel: request.Source.ChannelId,
+		Ts:      message.Msg.Timestamp,
+	})
+	if err != nil {
+		fmt.Fprintf(utils.Log, "Could not get the permalink of message %s: %s\n", message.Msg.Timestamp, err)
+		return nil
+	}
+
+	return write_file(destination, "permalink", permalink)
+}
+
+func write_file(destination string, name string, contents string) error {
+	err := os.WriteFile(filepath.Join(destination, name), []byte(contents), 0644)
+	if err != nil {
+		return fmt.Errorf("writing %s file: %w", name, err)
+	}
+	return nil
+}
+
+func get_message(request *utils.InRequest, slack_client Client) (slack.Message, error) {
+
+	timestamp := request.Version["timestamp"]
+	thread_ts := request.Version["thread_ts"]
+
+	var messages []slack.Message
+
+	if len(thread_ts) > 0 && thread_ts != timestamp {
+		params := slack.GetConversationRepliesParameters{
+			ChannelID: request.Source.ChannelId,
+			Timestamp: thread_ts,
+			Latest:    timestamp,
+			Oldest:    timestamp,
+			Inclusive: true,
+		}
+
+		replies, _, _, err := slack_client.GetConversationReplies(&params)
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("getting reply: %w", err)
+		}
+
+		for _, reply := range replies {
+			if reply.Msg.Timestamp == timestamp {
+				messages = append(messages, reply)
+			}
+		}
+	} else {
+		params := slack.GetConversationHistoryParameters{
+			ChannelID: request.Source.ChannelId,
+		}
+		params.Latest = timestamp
+		params.Inclusive = true
+		params.Limit = 1
+
+		history, err := slack_client.GetConversationHistory(&params)
+		if err != nil {
+			return slack.Message{}, fmt.Errorf("getting message: %w", err)
+		}
+
+		messages = history.Messages
+	}
+
+	if len(messages) < 1 {
+		return slack.Message{}, errors.New("message could not be found")
+	}
+
+	return messages[0], nil
+}
@@ -0,0 +1,280 @@
+package readresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+func in_request(t *testing.T, params string, version map[string]string) *utils.InRequest {
+	t.Helper()
+
+	var request utils.InRequest
+	payload := fmt.Sprintf(`{"source": {}, "params": %s}`, params)
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		t.Fatalf("parsing request: %s", err)
+	}
+	request.Source.ChannelId = channel
+	request.Version = version
+	return &request
+}
+
+func read_files(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading %s: %s", dir, err)
+	}
+
+	files := map[string]string{}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("reading %s: %s", entry.Name(), err)
+		}
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func TestGet(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.NameUser("U1", "alice")
+
+	older := server.Post(channel, "U1", "deploy staging", "")
+	parent := server.Post(channel, "U1", "deploy prod v1.2", "")
+	reply := server.Post(channel, "U2", "deploy canary v1.3", parent)
+	server.Post(channel, "U1", "not this one", "")
+
+	permalink := func(ts string) string {
+		return fakeslack.PermalinkPrefix + channel + "/p" + strings.ReplaceAll(ts, ".", "")
+	}
+
+	tests := []struct {
+		name    string
+		params  string
+		version map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "top-level message",
+			params:  `{}`,
+			version: map[string]string{"timestamp": older},
+			want: map[string]string{
+				"text":        "deploy staging",
+				"timestamp":   older,
+				"thread_ts":   older,
+				"reply_count": "0",
+				"user":        "U1",
+				"user_name":   "alice",
+				"permalink":   permalink(older),
+			},
+		},
+		{
+			name:    "text pattern",
+			params:  `{"text_pattern": "deploy (\\w+) (\\S+)"}`,
+			version: map[string]string{"timestamp": parent},
+			want: map[string]string{
+				"text":          "deploy prod v1.2",
+				"text_part1":    "prod",
+				"text_part2":    "v1.2",
+				"captures.json": `{"1":"prod","2":"v1.2"}`,
+				"timestamp":     parent,
+				"thread_ts":     parent,
+				"reply_count":   "1",
+				"user":          "U1",
+				"user_name":     "alice",
+				"permalink":     permalink(parent),
+			},
+		},
+		{
+			name:    "named groups",
+			params:  `{"text_pattern": "deploy (?P<env>\\w+) (\\S+)"}`,
+			version: map[string]string{"timestamp": parent},
+			want: map[string]string{
+				"text":          "deploy prod v1.2",
+				"text_part1":    "prod",
+				"text_part2":    "v1.2",
+				"text_env":      "prod",
+				"captures.json": `{"2":"v1.2","env":"prod"}`,
+				"timestamp":     parent,
+				"thread_ts":     parent,
+				"reply_count":   "1",
+				"user":          "U1",
+				"user_name":     "alice",
+				"permalink":     permalink(parent),
+			},
+		},
+		{
+			name:    "first matching pattern",
+			params:  `{"text_pattern": ["rollback (?P<env>\\w+)", "deploy (?P<env>\\w+) v(?P<version>\\S+)", "deploy (\\w+)"]}`,
+			version: map[string]string{"timestamp": parent},
+			want: map[string]string{
+				"text":          "deploy prod v1.2",
+				"text_part1":    "prod",
+				"text_part2":    "1.2",
+				"text_env":      "prod",
+				"text_version":  "1.2",
+				"captures.json": `{"env":"prod","version":"1.2"}`,
+				"timestamp":     parent,
+				"thread_ts":     parent,
+				"reply_count":   "1",
+				"user":          "U1",
+				"user_name":     "alice",
+				"permalink":     permalink(parent),
+			},
+		},
+		{
+			name:    "no matching pattern",
+			params:  `{"text_pattern": ["rollback (\\w+)"]}`,
+			version: map[string]string{"timestamp": older},
+			want: map[string]string{
+				"text":          "deploy staging",
+				"captures.json": `{}`,
+				"timestamp":     older,
+				"thread_ts":     older,
+				"reply_count":   "0",
+				"user":          "U1",
+				"user_name":     "alice",
+				"permalink":     permalink(older),
+			},
+		},
+		{
+			name:    "thread reply",
+			params:  `{"text_pattern": "deploy (\\w+)"}`,
+			version: map[string]string{"timestamp": reply, "thread_ts": parent},
+			want: map[string]string{
+				"text":          "deploy canary v1.3",
+				"text_part1":    "canary",
+				"captures.json": `{"1":"canary"}`,
+				"timestamp":     reply,
+				"thread_ts":     parent,
+				"reply_count":   "0",
+				"user":          "U2",
+				"permalink":     permalink(reply),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destination := t.TempDir()
+			request := in_request(t, test.params, test.version)
+
+			response, err := Get(request, destination, server.Client())
+			if err != nil {
+				t.Fatalf("Get() failed: %s", err)
+			}
+
+			if fmt.Sprint(response.Version) != fmt.Sprint(test.version) {
+				t.Errorf("get() returned version %v, want %v", response.Version, test.version)
+			}
+
+			files := read_files(t, destination)
+			if _, ok := files["message.json"]; !ok {
+				t.Errorf("get() did not write message.json")
+			}
+			delete(files, "message.json")
+
+			var version map[string]string
+			if err := json.Unmarshal([]byte(files["version.json"]), &version); err != nil || fmt.Sprint(version) != fmt.Sprint(test.version) {
+				t.Errorf("get() wrote version.json %q, want %v", files["version.json"], test.version)
+			}
+			delete(files, "version.json")
+
+			if fmt.Sprint(files) != fmt.Sprint(test.want) {
+				t.Errorf("get() wrote %v, want %v", files, test.want)
+			}
+		})
+	}
+}
+
+func TestGetMessageJson(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	ts := server.Add(channel, slack.Message{Msg: slack.Msg{
+		BotID:    "B1",
+		Username: "deploybot",
+		SubType:  "bot_message",
+		Text:     "Deploy?",
+		Attachments: []slack.Attachment{
+			{Fallback: "Approve deploy", CallbackID: "deploy"},
+		},
+	}})
+
+	destination := t.TempDir()
+	_, err := Get(in_request(t, `{}`, map[string]string{"timestamp": ts}), destination, server.Client())
+	if err != nil {
+		t.Fatalf("Get() failed: %s", err)
+	}
+
+	files := read_files(t, destination)
+	if files["user"] != "B1" || files["user_name"] != "deploybot" {
+		t.Errorf("author = %q %q, want the bot B1 deploybot", files["user"], files["user_name"])
+	}
+
+	var message slack.Message
+	if err := json.Unmarshal([]byte(files["message.json"]), &message); err != nil {
+		t.Fatalf("parsing message.json: %s", err)
+	}
+	if message.Timestamp != ts || message.BotID != "B1" || len(message.Attachments) != 1 || message.Attachments[0].CallbackID != "deploy" {
+		t.Errorf("message.json = %+v, want the full message", message)
+	}
+}
+
+func TestGetWithoutLookups(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.NameUser("U1", "alice")
+	ts := server.Post(channel, "U1", "deploy", "")
+
+	server.Fail("users.info", "missing_scope")
+	server.Fail("chat.getPermalink", "internal_error")
+
+	destination := t.TempDir()
+	_, err := Get(in_request(t, `{}`, map[string]string{"timestamp": ts}), destination, server.Client())
+	if err != nil {
+		t.Fatalf("Get() failed: %s", err)
+	}
+
+	files := read_files(t, destination)
+	if files["text"] != "deploy" || files["user"] != "U1" {
+		t.Errorf("get() wrote %v, want the message and its author", files)
+	}
+	for _, name := range []string{"user_name", "permalink"} {
+		if _, ok := files[name]; ok {
+			t.Errorf("get() wrote %s, want it skipped", name)
+		}
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	ts := server.Post(channel, "U1", "deploy", "")
+
+	server.Fail("conversations.history", "channel_not_found")
+
+	_, err := Get(in_request(t, `{}`, map[string]string{"timestamp": ts}), t.TempDir(), server.Client())
+	if err == nil {
+		t.Errorf("Get() succeeded, want an error")
+	}
+
+	_, err = Get(in_request(t, `{}`, map[string]string{}), t.TempDir(), server.Client())
+	if err == nil {
+		t.Errorf("Get() without timestamp succeeded, want an error")
+	}
+}
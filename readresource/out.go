@@ -0,0 +1,168 @@
+package readresource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+// Put acts on the message fetched by a get of the read resource, found in
+// params.message_dir: it removes and adds reactions, then replies in the
+// message thread.
+func Put(request *utils.ReactRequest, source_dir string, slack_client Client) (utils.OutResponse, error) {
+
+	var response utils.OutResponse
+
+	request = request.Clone()
+
+	params := &request.Params
+
+	if len(params.MessageDir) == 0 {
+		return response, errors.New("missing params field: message_dir")
+	}
+
+	if len(params.AddReactions) == 0 && len(params.RemoveReactions) == 0 &&
+		len(params.Reply) == 0 && len(params.ReplyFile) == 0 {
+		return response, errors.New("missing params field: add_reactions, remove_reactions, reply or reply_file")
+	}
+
+	if len(params.Reply) > 0 && len(params.ReplyFile) > 0 {
+		return response, errors.New("params fields reply and reply_file cannot be used together")
+	}
+
+	if len(request.Source.ChannelId) == 0 && len(request.Source.ChannelName) == 0 {
+		return response, errors.New("missing source field: channel_id or channel_name")
+	}
+
+	message_dir := filepath.Join(source_dir, params.MessageDir)
+
+	timestamp, err := read_message_file(message_dir, "timestamp")
+	if err != nil {
+		return response, err
+	}
+
+	// Files written before thread_ts was introduced only have a timestamp.
+	thread_ts, err := read_message_file(message_dir, "thread_ts")
+	if errors.Is(err, os.ErrNotExist) {
+		thread_ts = timestamp
+	} else if err != nil {
+		return response, err
+	}
+
+	reply := params.Reply
+	if len(params.ReplyFile) > 0 {
+		reply, err = read_message_file(source_dir, params.ReplyFile)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	err = request.Source.ResolveChannelId(slack_client)
+	if err != nil {
+		return response, fmt.Errorf("resolving channel: %w", err)
+	}
+
+	fmt.Fprintf(utils.Log, "Acting on message %s in thread %s\n", timestamp, thread_ts)
+
+	ref := slack.NewRefToMessage(request.Source.ChannelId, timestamp)
+
+	for _, name := range params.RemoveReactions {
+		name = emoji_name(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(utils.Log, "Removing reaction: %s\n", name)
+		err := slack_client.RemoveReaction(name, ref)
+		if err != nil && !is_slack_error(err, "no_reaction") {
+			return response, fmt.Errorf("removing reaction %s: %w", name, err)
+		}
+	}
+
+	for _, name := range params.AddReactions {
+		name = emoji_name(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(utils.Log, "Adding reaction: %s\n", name)
+		err := slack_client.AddReaction(name, ref)
+		if err != nil && !is_slack_error(err, "already_reacted") {
+			return response, fmt.Errorf("adding reaction %s: %w", name, err)
+		}
+	}
+
+	if len(reply) > 0 {
+		options := []slack.MsgOption{
+			slack.MsgOptionText(reply, false),
+			slack.MsgOptionTS(thread_ts),
+		}
+		if params.ReplyBroadcast {
+			options = append(options, slack.MsgOptionBroadcast())
+		}
+
+		_, reply_ts, err := slack_client.PostMessage(request.Source.ChannelId, options...)
+		if err != nil {
+			return response, fmt.Errorf("replying: %w", err)
+		}
+
+		fmt.Fprintf(utils.Log, "Replied: ts=%s\n", reply_ts)
+		response.Metadata = append(response.Metadata, utils.MetadataField{Name: "reply", Value: reply_ts})
+	}
+
+	// The version is the one reported by check for the message, so that the
+	// put does not make up a new version triggering jobs.
+	response.Version, err = read_message_version(message_dir)
+	if errors.Is(err, os.ErrNotExist) {
+		// Files written before version.json was introduced.
+		response.Version = utils.Version{"timestamp": timestamp}
+		if thread_ts != timestamp {
+			response.Version["thread_ts"] = thread_ts
+		}
+	} else if err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
+// read_message_version reads the version fetched by the get.
+func read_message_version(dir string) (utils.Version, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "version.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading version.json file: %w", err)
+	}
+
+	var version utils.Version
+	err = json.Unmarshal(data, &version)
+	if err != nil {
+		return nil, fmt.Errorf("parsing version.json file: %w", err)
+	}
+
+	return version, nil
+}
+
+func read_message_file(dir string, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("reading %s file: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// emoji_name accepts emoji names with or without surrounding colons.
+func emoji_name(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(name), ":"), ":")
+}
+
+// is_slack_error reports whether err is the Slack API error with the given code.
+func is_slack_error(err error, code string) bool {
+	var slack_err slack.SlackErrorResponse
+	return errors.As(err, &slack_err) && slack_err.Err == code
+}
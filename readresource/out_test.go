@@ -0,0 +1,202 @@
+package readresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+	"github.com/apptweak/concourse-slack-chat-resources/utils"
+	"github.com/slack-go/slack"
+)
+
+func react_request(t *testing.T, params string) *utils.ReactRequest {
+	t.Helper()
+
+	var request utils.ReactRequest
+	payload := fmt.Sprintf(`{"source": {}, "params": %s}`, params)
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		t.Fatalf("parsing request: %s", err)
+	}
+	request.Source.ChannelId = channel
+	return &request
+}
+
+// get_into runs a get of the message into a directory of source_dir.
+func get_into(t *testing.T, server *fakeslack.Server, source_dir string, version map[string]string) {
+	t.Helper()
+
+	_, err := Get(in_request(t, `{}`, version), filepath.Join(source_dir, "slack-in"), server.Client())
+	if err != nil {
+		t.Fatalf("Get() failed: %s", err)
+	}
+}
+
+func reaction_names(message *slack.Message) []string {
+	names := []string{}
+	for _, reaction := range message.Reactions {
+		names = append(names, reaction.Name)
+	}
+	return names
+}
+
+func TestPut(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	ts := server.Post(channel, "U1", "@bot deploy", "")
+	source_dir := t.TempDir()
+	get_into(t, server, source_dir, map[string]string{"timestamp": ts})
+
+	response, err := Put(react_request(t, `{"message_dir": "slack-in", "add_reactions": [":eyes:"]}`), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+	if fmt.Sprint(response.Version) != fmt.Sprint(utils.Version{"timestamp": ts}) {
+		t.Errorf("version = %v, want the message version", response.Version)
+	}
+
+	if err := os.WriteFile(filepath.Join(source_dir, "reply"), []byte("Deployed.\n"), 0644); err != nil {
+		t.Fatalf("writing reply: %s", err)
+	}
+
+	params := `{
+		"message_dir": "slack-in",
+		"remove_reactions": ["eyes"],
+		"add_reactions": ["white_check_mark", "white_check_mark"],
+		"reply_file": "reply"
+	}`
+	response, err = Put(react_request(t, params), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	message := server.Message(channel, ts)
+	if fmt.Sprint(reaction_names(message)) != "[white_check_mark]" {
+		t.Errorf("reactions = %v, want [white_check_mark]", reaction_names(message))
+	}
+
+	if len(response.Metadata) != 1 || response.Metadata[0].Name != "reply" {
+		t.Fatalf("metadata = %v, want the reply", response.Metadata)
+	}
+	reply := server.Message(channel, response.Metadata[0].Value)
+	if reply == nil || reply.Text != "Deployed." || reply.ThreadTimestamp != ts {
+		t.Errorf("reply = %+v, want \"Deployed.\" in thread %s", reply, ts)
+	}
+}
+
+func TestPutReply(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	parent := server.Post(channel, "U1", "release thread", "")
+	ts := server.Post(channel, "U1", "@bot deploy", parent)
+	source_dir := t.TempDir()
+	get_into(t, server, source_dir, map[string]string{"timestamp": ts, "thread_ts": parent})
+
+	response, err := Put(react_request(t, `{"message_dir": "slack-in", "add_reactions": ["eyes"], "reply": "On it"}`), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	want := utils.Version{"timestamp": ts, "thread_ts": parent}
+	if fmt.Sprint(response.Version) != fmt.Sprint(want) {
+		t.Errorf("version = %v, want %v", response.Version, want)
+	}
+
+	if names := reaction_names(server.Message(channel, ts)); fmt.Sprint(names) != "[eyes]" {
+		t.Errorf("reactions = %v, want the reply to have [eyes]", names)
+	}
+
+	reply := server.Message(channel, response.Metadata[0].Value)
+	if reply == nil || reply.ThreadTimestamp != parent {
+		t.Errorf("reply = %+v, want it in thread %s", reply, parent)
+	}
+}
+
+func TestPutEditedVersion(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	first := server.Post(channel, "U1", "deploy v1", "")
+	second := server.Post(channel, "U1", "deploy v2", "")
+	server.Edit(channel, first, "deploy v1.1")
+
+	versions, err := Check(check_request(t, `{"include_edits": true}`, `{"timestamp": "`+second+`"}`), server.Client())
+	if err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+	version := versions[len(versions)-1]
+	if _, ok := version["edited"]; !ok {
+		t.Fatalf("Check() = %v, want the edited message last", versions)
+	}
+
+	source_dir := t.TempDir()
+	get_into(t, server, source_dir, version)
+
+	response, err := Put(react_request(t, `{"message_dir": "slack-in", "add_reactions": ["eyes"]}`), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+	if fmt.Sprint(response.Version) != fmt.Sprint(version) {
+		t.Errorf("version = %v, want the checked version %v", response.Version, version)
+	}
+}
+
+func TestPutWithoutVersionFile(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	parent := server.Post(channel, "U1", "release thread", "")
+	ts := server.Post(channel, "U1", "@bot deploy", parent)
+	source_dir := t.TempDir()
+	get_into(t, server, source_dir, map[string]string{"timestamp": ts, "thread_ts": parent})
+
+	// Directories written by older gets have no version.json.
+	if err := os.Remove(filepath.Join(source_dir, "slack-in", "version.json")); err != nil {
+		t.Fatalf("removing version.json: %s", err)
+	}
+
+	response, err := Put(react_request(t, `{"message_dir": "slack-in", "add_reactions": ["eyes"]}`), source_dir, server.Client())
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	want := utils.Version{"timestamp": ts, "thread_ts": parent}
+	if fmt.Sprint(response.Version) != fmt.Sprint(want) {
+		t.Errorf("version = %v, want %v", response.Version, want)
+	}
+}
+
+func TestPutErrors(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	ts := server.Post(channel, "U1", "@bot deploy", "")
+	source_dir := t.TempDir()
+	get_into(t, server, source_dir, map[string]string{"timestamp": ts})
+
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{name: "no message_dir", params: `{"add_reactions": ["eyes"]}`},
+		{name: "nothing to do", params: `{"message_dir": "slack-in"}`},
+		{name: "reply and reply_file", params: `{"message_dir": "slack-in", "reply": "a", "reply_file": "b"}`},
+		{name: "missing message_dir", params: `{"message_dir": "missing", "add_reactions": ["eyes"]}`},
+		{name: "slack error", params: `{"message_dir": "slack-in", "add_reactions": ["eyes"]}`},
+	}
+
+	server.Fail("reactions.add", "invalid_name")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Put(react_request(t, test.params), source_dir, server.Client())
+			if err == nil {
+				t.Errorf("Put(%s) succeeded, want an error", test.params)
+			}
+		})
+	}
+}
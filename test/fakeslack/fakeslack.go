@@ -0,0 +1,826 @@
+// Package fakeslack provides an in-process fake of the Slack Web API, serving
+// the methods used by the resources, so that they can be tested offline.
+package fakeslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Identity of the token used against the fake.
+const (
+	BotUserId = "UBOT"
+	BotId     = "BBOT"
+)
+
+// Channel receiving the messages posted to the incoming webhook.
+const WebhookChannel = "CWEBHOOK"
+
+// Prefix of the message links returned by chat.getPermalink.
+const PermalinkPrefix = "https://fake.slack.com/archives/"
+
+type Request struct {
+	Method string
+	Form   url.Values
+}
+
+type Upload struct {
+	FileId   string
+	Filename string
+	Title    string
+	Content  string
+	Channel  string
+	ThreadTs string
+}
+
+// Scheduled is a message scheduled with chat.scheduleMessage.
+type Scheduled struct {
+	Id      string
+	Channel string
+	PostAt  string
+	Text    string
+}
+
+// Ephemeral is a message sent with chat.postEphemeral.
+type Ephemeral struct {
+	Channel string
+	User    string
+	Ts      string
+	Text    string
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	messages   map[string][]slack.Message
+	channels   []slack.Channel
+	users      map[string]string
+	user_names map[string]string
+	usergroups []slack.UserGroup
+	uploads    map[string]*Upload
+	failures   map[string]string
+	requests   []Request
+	webhooks   []slack.WebhookMessage
+	scheduled  []Scheduled
+	ephemerals []Ephemeral
+	last_ts    int
+}
+
+// New starts a fake Slack server. Close it when done.
+func New() *Server {
+	server := &Server{
+		messages:   map[string][]slack.Message{},
+		uploads:    map[string]*Upload{},
+		users:      map[string]string{},
+		user_names: map[string]string{},
+		failures:   map[string]string{},
+		last_ts:    1700000000,
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+// APIURL is the value to give to source.api_url.
+func (server *Server) APIURL() string {
+	return server.URL + "/api/"
+}
+
+// WebhookURL is the value to give to source.webhook_url.
+func (server *Server) WebhookURL() string {
+	return server.URL + "/services/T00000000/B00000000/secret"
+}
+
+// Webhooks returns the payloads posted to the incoming webhook.
+func (server *Server) Webhooks() []slack.WebhookMessage {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]slack.WebhookMessage{}, server.webhooks...)
+}
+
+// AddChannel makes a channel visible to conversations.list.
+func (server *Server) AddChannel(id string, name string, is_member bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	var channel slack.Channel
+	channel.ID = id
+	channel.Name = name
+	channel.IsMember = is_member
+	server.channels = append(server.channels, channel)
+}
+
+// Post adds a message as if posted by a user, and returns its timestamp.
+// A non-empty thread_ts makes it a reply in that thread.
+func (server *Server) Post(channel string, user string, text string, thread_ts string) string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	var message slack.Message
+	message.Type = "message"
+	message.User = user
+	message.Text = text
+	message.ThreadTimestamp = thread_ts
+
+	return server.add(channel, message)
+}
+
+// Add adds a message as is. Its timestamp is generated if empty.
+func (server *Server) Add(channel string, message slack.Message) string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.add(channel, message)
+}
+
+// AddUser makes a user visible to users.lookupByEmail.
+func (server *Server) AddUser(id string, email string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.users[email] = id
+}
+
+// NameUser gives a user the name returned by users.info.
+func (server *Server) NameUser(id string, name string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.user_names[id] = name
+}
+
+// AddUsergroup makes a usergroup and its members visible to usergroups.list
+// and usergroups.users.list.
+func (server *Server) AddUsergroup(id string, handle string, members ...string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	var usergroup slack.UserGroup
+	usergroup.ID = id
+	usergroup.Handle = handle
+	usergroup.Users = members
+	server.usergroups = append(server.usergroups, usergroup)
+}
+
+// Edit changes the text of a message as its author would, and returns the
+// timestamp of the edit.
+func (server *Server) Edit(channel string, ts string, text string) string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	index := server.find(channel, ts)
+	if index < 0 {
+		return ""
+	}
+
+	message := &server.messages[channel][index]
+	message.Text = text
+	message.Edited = &slack.Edited{User: message.User, Timestamp: server.next_ts()}
+
+	return message.Edited.Timestamp
+}
+
+// React adds a reaction of the user to a message.
+func (server *Server) React(channel string, ts string, user string, name string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	index := server.find(channel, ts)
+	if index < 0 {
+		return
+	}
+
+	message := &server.messages[channel][index]
+	for i := range message.Reactions {
+		if message.Reactions[i].Name == name {
+			message.Reactions[i].Users = append(message.Reactions[i].Users, user)
+			message.Reactions[i].Count++
+			return
+		}
+	}
+	message.Reactions = append(message.Reactions, slack.ItemReaction{Name: name, Count: 1, Users: []string{user}})
+}
+
+// Message returns the message with the given timestamp, or nil.
+func (server *Server) Message(channel string, ts string) *slack.Message {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if index := server.find(channel, ts); index >= 0 {
+		message := server.messages[channel][index]
+		return &message
+	}
+	return nil
+}
+
+// Messages returns the messages of a channel, oldest first.
+func (server *Server) Messages(channel string) []slack.Message {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]slack.Message{}, server.messages[channel]...)
+}
+
+// Scheduled returns the messages scheduled and not cancelled so far.
+func (server *Server) Scheduled() []Scheduled {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]Scheduled{}, server.scheduled...)
+}
+
+// Ephemerals returns the ephemeral messages sent so far.
+func (server *Server) Ephemerals() []Ephemeral {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]Ephemeral{}, server.ephemerals...)
+}
+
+// DirectChannel returns the ID of the direct message channel opened with a
+// user by conversations.open.
+func DirectChannel(user string) string {
+	return "D" + user
+}
+
+// Uploads returns the files uploaded so far.
+func (server *Server) Uploads() []Upload {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	uploads := []Upload{}
+	for _, upload := range server.uploads {
+		uploads = append(uploads, *upload)
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].FileId < uploads[j].FileId })
+	return uploads
+}
+
+// Requests returns the calls made to the given API method.
+func (server *Server) Requests(method string) []Request {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	requests := []Request{}
+	for _, request := range server.requests {
+		if request.Method == method {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// Fail makes every later call to the API method fail with the Slack error
+// code. Use "webhook" as the method to make the incoming webhook fail.
+func (server *Server) Fail(method string, error_code string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.failures[method] = error_code
+}
+
+func (server *Server) add(channel string, message slack.Message) string {
+	if len(message.Timestamp) == 0 {
+		message.Timestamp = server.next_ts()
+	}
+	message.Channel = channel
+
+	messages := append(server.messages[channel], message)
+	sort.SliceStable(messages, func(i, j int) bool {
+		return ts_value(messages[i].Timestamp) < ts_value(messages[j].Timestamp)
+	})
+	server.messages[channel] = messages
+
+	return message.Timestamp
+}
+
+// next_ts returns a timestamp newer than all the previous ones.
+func (server *Server) next_ts() string {
+	server.last_ts++
+	return fmt.Sprintf("%d.000100", server.last_ts)
+}
+
+func (server *Server) find(channel string, ts string) int {
+	for i, message := range server.messages[channel] {
+		if message.Timestamp == ts {
+			return i
+		}
+	}
+	return -1
+}
+
+func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/upload/") {
+		server.handle_upload(w, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/services/") {
+		server.handle_webhook(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.requests = append(server.requests, Request{Method: method, Form: r.Form})
+
+	if error_code, ok := server.failures[method]; ok {
+		respond(w, map[string]interface{}{"ok": false, "error": error_code})
+		return
+	}
+
+	var response map[string]interface{}
+
+	switch method {
+	case "auth.test":
+		response = map[string]interface{}{"user_id": BotUserId, "bot_id": BotId}
+	case "conversations.list":
+		response = map[string]interface{}{"channels": server.channels}
+	case "conversations.history":
+		response = server.history(r.Form)
+	case "conversations.replies":
+		response = server.replies(r.Form)
+	case "chat.postMessage":
+		response = server.post_message(r.Form)
+	case "chat.postEphemeral":
+		response = server.post_ephemeral(r.Form)
+	case "chat.scheduleMessage":
+		response = server.schedule_message(r.Form)
+	case "chat.deleteScheduledMessage":
+		response = server.delete_scheduled_message(r.Form)
+	case "conversations.open":
+		response = server.open_conversation(r.Form)
+	case "chat.update":
+		response = server.update_message(r.Form)
+	case "chat.delete":
+		response = server.delete_message(r.Form)
+	case "users.lookupByEmail":
+		response = server.lookup_user(r.Form)
+	case "users.info":
+		response = server.user_info(r.Form)
+	case "chat.getPermalink":
+		response = server.permalink(r.Form)
+	case "usergroups.list":
+		response = map[string]interface{}{"usergroups": server.usergroups}
+	case "usergroups.users.list":
+		response = server.usergroup_members(r.Form)
+	case "reactions.add":
+		response = server.add_reaction(r.Form)
+	case "reactions.remove":
+		response = server.remove_reaction(r.Form)
+	case "files.getUploadURLExternal":
+		response = server.get_upload_url(r.Form)
+	case "files.completeUploadExternal":
+		response = server.complete_upload(r.Form)
+	default:
+		response = map[string]interface{}{"ok": false, "error": "unknown_method"}
+	}
+
+	if _, ok := response["ok"]; !ok {
+		response["ok"] = true
+	}
+	respond(w, response)
+}
+
+func (server *Server) history(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+
+	// Newest first, without replies, but with the thread summary of parents.
+	messages := []slack.Message{}
+	for i := len(server.messages[channel]) - 1; i >= 0; i-- {
+		message := server.messages[channel][i]
+		if is_reply(message) || !in_range(message.Timestamp, form) {
+			continue
+		}
+		server.summarize_thread(channel, &message)
+		messages = append(messages, message)
+	}
+
+	page, has_more, cursor := paginate(messages, form)
+
+	return map[string]interface{}{
+		"messages":          page,
+		"has_more":          has_more,
+		"response_metadata": map[string]string{"next_cursor": cursor},
+	}
+}
+
+func (server *Server) replies(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	thread_ts := form.Get("ts")
+
+	index := server.find(channel, thread_ts)
+	if index < 0 {
+		return map[string]interface{}{"ok": false, "error": "thread_not_found"}
+	}
+
+	parent := server.messages[channel][index]
+	server.summarize_thread(channel, &parent)
+
+	// The parent first, then its replies, oldest first.
+	messages := []slack.Message{parent}
+	for _, message := range server.messages[channel] {
+		if is_reply(message) && message.ThreadTimestamp == thread_ts && in_range(message.Timestamp, form) {
+			messages = append(messages, message)
+		}
+	}
+
+	page, has_more, cursor := paginate(messages, form)
+
+	return map[string]interface{}{
+		"messages":          page,
+		"has_more":          has_more,
+		"response_metadata": map[string]string{"next_cursor": cursor},
+	}
+}
+
+func (server *Server) summarize_thread(channel string, parent *slack.Message) {
+	for _, message := range server.messages[channel] {
+		if is_reply(message) && message.ThreadTimestamp == parent.Timestamp {
+			parent.ThreadTimestamp = parent.Timestamp
+			parent.ReplyCount++
+			parent.LatestReply = message.Timestamp
+		}
+	}
+}
+
+func (server *Server) post_message(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	if len(channel) == 0 {
+		return map[string]interface{}{"ok": false, "error": "channel_not_found"}
+	}
+
+	var message slack.Message
+	message.Type = "message"
+	message.User = BotUserId
+	message.BotID = BotId
+	message.ThreadTimestamp = form.Get("thread_ts")
+	if err := decode_content(form, &message); err != nil {
+		return map[string]interface{}{"ok": false, "error": "invalid_blocks"}
+	}
+
+	ts := server.add(channel, message)
+
+	return map[string]interface{}{"channel": channel, "ts": ts, "message": server.messages[channel][server.find(channel, ts)]}
+}
+
+func (server *Server) post_ephemeral(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	user := form.Get("user")
+	if len(channel) == 0 {
+		return map[string]interface{}{"ok": false, "error": "channel_not_found"}
+	}
+	if len(user) == 0 {
+		return map[string]interface{}{"ok": false, "error": "user_not_in_channel"}
+	}
+
+	var message slack.Message
+	if err := decode_content(form, &message); err != nil {
+		return map[string]interface{}{"ok": false, "error": "invalid_blocks"}
+	}
+
+	// Ephemeral messages are not stored in the channel history.
+	ts := server.next_ts()
+	server.ephemerals = append(server.ephemerals, Ephemeral{Channel: channel, User: user, Ts: ts, Text: message.Text})
+
+	return map[string]interface{}{"message_ts": ts}
+}
+
+func (server *Server) schedule_message(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	if len(channel) == 0 {
+		return map[string]interface{}{"ok": false, "error": "channel_not_found"}
+	}
+
+	post_at, err := strconv.ParseInt(form.Get("post_at"), 10, 64)
+	if err != nil || post_at <= time.Now().Unix() {
+		return map[string]interface{}{"ok": false, "error": "time_in_past"}
+	}
+
+	var message slack.Message
+	if err := decode_content(form, &message); err != nil {
+		return map[string]interface{}{"ok": false, "error": "invalid_blocks"}
+	}
+
+	id := fmt.Sprintf("Q%08d", len(server.scheduled)+1)
+	server.scheduled = append(server.scheduled, Scheduled{Id: id, Channel: channel, PostAt: form.Get("post_at"), Text: message.Text})
+
+	return map[string]interface{}{"channel": channel, "scheduled_message_id": id, "post_at": post_at}
+}
+
+func (server *Server) delete_scheduled_message(form url.Values) map[string]interface{} {
+	for i, scheduled := range server.scheduled {
+		if scheduled.Id == form.Get("scheduled_message_id") && scheduled.Channel == form.Get("channel") {
+			server.scheduled = append(server.scheduled[:i], server.scheduled[i+1:]...)
+			return map[string]interface{}{}
+		}
+	}
+
+	return map[string]interface{}{"ok": false, "error": "invalid_scheduled_message_id"}
+}
+
+func (server *Server) open_conversation(form url.Values) map[string]interface{} {
+	users := strings.Split(form.Get("users"), ",")
+	if len(users) != 1 || len(users[0]) == 0 {
+		return map[string]interface{}{"ok": false, "error": "not_implemented"}
+	}
+
+	return map[string]interface{}{"channel": map[string]interface{}{"id": DirectChannel(users[0]), "is_im": true}}
+}
+
+func (server *Server) update_message(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	ts := form.Get("ts")
+
+	index := server.find(channel, ts)
+	if index < 0 {
+		return map[string]interface{}{"ok": false, "error": "message_not_found"}
+	}
+
+	message := &server.messages[channel][index]
+	message.Blocks = slack.Blocks{}
+	message.Attachments = nil
+	if err := decode_content(form, message); err != nil {
+		return map[string]interface{}{"ok": false, "error": "invalid_blocks"}
+	}
+	message.Edited = &slack.Edited{User: BotUserId, Timestamp: server.next_ts()}
+
+	return map[string]interface{}{"channel": channel, "ts": ts, "text": message.Text}
+}
+
+func (server *Server) delete_message(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	ts := form.Get("ts")
+
+	index := server.find(channel, ts)
+	if index < 0 {
+		return map[string]interface{}{"ok": false, "error": "message_not_found"}
+	}
+
+	server.messages[channel] = append(server.messages[channel][:index], server.messages[channel][index+1:]...)
+
+	return map[string]interface{}{"channel": channel, "ts": ts}
+}
+
+func (server *Server) add_reaction(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	name := form.Get("name")
+
+	index := server.find(channel, form.Get("timestamp"))
+	if index < 0 {
+		return map[string]interface{}{"ok": false, "error": "message_not_found"}
+	}
+
+	message := &server.messages[channel][index]
+	for _, reaction := range message.Reactions {
+		if reaction.Name == name {
+			return map[string]interface{}{"ok": false, "error": "already_reacted"}
+		}
+	}
+	message.Reactions = append(message.Reactions, slack.ItemReaction{Name: name, Count: 1, Users: []string{BotUserId}})
+
+	return map[string]interface{}{}
+}
+
+func (server *Server) lookup_user(form url.Values) map[string]interface{} {
+	id, ok := server.users[form.Get("email")]
+	if !ok {
+		return map[string]interface{}{"ok": false, "error": "users_not_found"}
+	}
+
+	return map[string]interface{}{"user": map[string]interface{}{"id": id, "profile": map[string]interface{}{"email": form.Get("email")}}}
+}
+
+func (server *Server) user_info(form url.Values) map[string]interface{} {
+	name, ok := server.user_names[form.Get("user")]
+	if !ok {
+		return map[string]interface{}{"ok": false, "error": "user_not_found"}
+	}
+
+	return map[string]interface{}{"user": map[string]interface{}{"id": form.Get("user"), "name": name}}
+}
+
+func (server *Server) permalink(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	ts := form.Get("message_ts")
+	if server.find(channel, ts) < 0 {
+		return map[string]interface{}{"ok": false, "error": "message_not_found"}
+	}
+
+	return map[string]interface{}{
+		"channel":   channel,
+		"permalink": PermalinkPrefix + channel + "/p" + strings.ReplaceAll(ts, ".", ""),
+	}
+}
+
+func (server *Server) usergroup_members(form url.Values) map[string]interface{} {
+	for _, usergroup := range server.usergroups {
+		if usergroup.ID == form.Get("usergroup") {
+			return map[string]interface{}{"users": usergroup.Users}
+		}
+	}
+
+	return map[string]interface{}{"ok": false, "error": "no_such_subteam"}
+}
+
+func (server *Server) remove_reaction(form url.Values) map[string]interface{} {
+	channel := form.Get("channel")
+	name := form.Get("name")
+
+	index := server.find(channel, form.Get("timestamp"))
+	if index < 0 {
+		return map[string]interface{}{"ok": false, "error": "message_not_found"}
+	}
+
+	message := &server.messages[channel][index]
+	for i, reaction := range message.Reactions {
+		if reaction.Name == name {
+			message.Reactions = append(message.Reactions[:i], message.Reactions[i+1:]...)
+			return map[string]interface{}{}
+		}
+	}
+
+	return map[string]interface{}{"ok": false, "error": "no_reaction"}
+}
+
+func (server *Server) get_upload_url(form url.Values) map[string]interface{} {
+	file_id := fmt.Sprintf("F%05d", len(server.uploads)+1)
+	server.uploads[file_id] = &Upload{FileId: file_id, Filename: form.Get("filename")}
+
+	return map[string]interface{}{"upload_url": server.URL + "/upload/" + file_id, "file_id": file_id}
+}
+
+func (server *Server) handle_upload(w http.ResponseWriter, r *http.Request) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	upload, ok := server.uploads[strings.TrimPrefix(r.URL.Path, "/upload/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	upload.Content = string(content)
+
+	w.Write([]byte("OK - " + strconv.Itoa(len(content))))
+}
+
+// handle_webhook serves incoming webhooks, which take a JSON payload and
+// answer in plain text.
+func (server *Server) handle_webhook(w http.ResponseWriter, r *http.Request) {
+	var payload slack.WebhookMessage
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+		return
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if error_code, ok := server.failures["webhook"]; ok {
+		http.Error(w, error_code, http.StatusBadRequest)
+		return
+	}
+
+	server.webhooks = append(server.webhooks, payload)
+
+	var message slack.Message
+	message.Type = "message"
+	message.BotID = BotId
+	message.Text = payload.Text
+	message.ThreadTimestamp = payload.ThreadTimestamp
+	message.Attachments = payload.Attachments
+	if payload.Blocks != nil {
+		message.Blocks = *payload.Blocks
+	}
+	server.add(WebhookChannel, message)
+
+	w.Write([]byte("ok"))
+}
+
+func (server *Server) complete_upload(form url.Values) map[string]interface{} {
+	var files []slack.FileSummary
+	if err := json.Unmarshal([]byte(form.Get("files")), &files); err != nil {
+		return map[string]interface{}{"ok": false, "error": "invalid_arguments"}
+	}
+
+	for _, file := range files {
+		upload, ok := server.uploads[file.ID]
+		if !ok {
+			return map[string]interface{}{"ok": false, "error": "file_not_found"}
+		}
+		upload.Title = file.Title
+		upload.Channel = form.Get("channel_id")
+		upload.ThreadTs = form.Get("thread_ts")
+	}
+
+	return map[string]interface{}{"files": files}
+}
+
+func decode_content(form url.Values, message *slack.Message) error {
+	message.Text = form.Get("text")
+
+	if blocks := form.Get("blocks"); len(blocks) > 0 {
+		if err := json.Unmarshal([]byte(blocks), &message.Blocks); err != nil {
+			return err
+		}
+	}
+
+	if attachments := form.Get("attachments"); len(attachments) > 0 {
+		if err := json.Unmarshal([]byte(attachments), &message.Attachments); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func is_reply(message slack.Message) bool {
+	return len(message.ThreadTimestamp) > 0 && message.ThreadTimestamp != message.Timestamp
+}
+
+// in_range applies the oldest, latest and inclusive parameters.
+func in_range(ts string, form url.Values) bool {
+	value := ts_value(ts)
+	inclusive := form.Get("inclusive") == "1" || form.Get("inclusive") == "true"
+
+	if oldest := form.Get("oldest"); len(oldest) > 0 {
+		if value < ts_value(oldest) || (!inclusive && value == ts_value(oldest)) {
+			return false
+		}
+	}
+
+	if latest := form.Get("latest"); len(latest) > 0 {
+		if value > ts_value(latest) || (!inclusive && value == ts_value(latest)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// paginate returns the page selected by the cursor and limit parameters. The
+// cursor is the offset of the page.
+func paginate(messages []slack.Message, form url.Values) ([]slack.Message, bool, string) {
+	limit, _ := strconv.Atoi(form.Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(form.Get("cursor"))
+
+	if offset >= len(messages) {
+		return []slack.Message{}, false, ""
+	}
+
+	end := offset + limit
+	if end >= len(messages) {
+		return messages[offset:], false, ""
+	}
+
+	return messages[offset:end], true, strconv.Itoa(end)
+}
+
+func ts_value(ts string) float64 {
+	value, _ := strconv.ParseFloat(ts, 64)
+	return value
+}
+
+func respond(w http.ResponseWriter, response map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Client returns a Slack client calling the fake.
+func (server *Server) Client() *slack.Client {
+	return slack.New("xoxb-fake", slack.OptionAPIURL(server.APIURL()))
+}
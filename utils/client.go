@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// NewSlackClient returns the Slack API client configured by the source: its
+// token, API URL and HTTP options.
+func NewSlackClient(source *Source) (*slack.Client, error) {
+	http_client, err := source.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []slack.Option{slack.OptionHTTPClient(http_client)}
+
+	if len(source.ApiUrl) > 0 {
+		api_url := source.ApiUrl
+		if !strings.HasSuffix(api_url, "/") {
+			api_url += "/"
+		}
+		options = append(options, slack.OptionAPIURL(api_url))
+	}
+
+	return slack.New(source.Token, options...), nil
+}
+
+// HTTPClient returns the HTTP client used to call Slack, going through the
+// configured proxy, trusting the configured CAs, and retrying calls as
+// configured by source.retry.
+func (source *Source) HTTPClient() (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+
+	if len(source.Proxy) > 0 {
+		proxy_url, err := url.Parse(source.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing source field proxy: %w", err)
+		}
+		if (proxy_url.Scheme != "http" && proxy_url.Scheme != "https") || len(proxy_url.Host) == 0 {
+			return nil, fmt.Errorf("parsing source field proxy: expected an http or https URL, e.g. http://proxy.example.com:3128")
+		}
+		base.Proxy = http.ProxyURL(proxy_url)
+	}
+
+	if len(source.CaCerts) > 0 || source.InsecureSkipVerify {
+		tls_config := &tls.Config{InsecureSkipVerify: source.InsecureSkipVerify}
+
+		if len(source.CaCerts) > 0 {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM([]byte(source.CaCerts)) {
+				return nil, fmt.Errorf("parsing source field ca_certs: no PEM certificate found")
+			}
+			tls_config.RootCAs = pool
+		}
+
+		base.TLSClientConfig = tls_config
+	}
+
+	transport := &retry_transport{
+		next:         base,
+		max_attempts: default_max_attempts,
+		max_wait:     default_max_wait,
+	}
+
+	if len(source.Timeout) > 0 {
+		timeout, err := time.ParseDuration(source.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("parsing source field timeout: %w", err)
+		}
+		transport.timeout = timeout
+	}
+
+	if source.Retry != nil {
+		if source.Retry.MaxAttempts > 0 {
+			transport.max_attempts = source.Retry.MaxAttempts
+		}
+
+		if len(source.Retry.MaxWait) > 0 {
+			max_wait, err := time.ParseDuration(source.Retry.MaxWait)
+			if err != nil {
+				return nil, fmt.Errorf("parsing source field retry.max_wait: %w", err)
+			}
+			transport.max_wait = max_wait
+		}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSlackClientApiUrl(t *testing.T) {
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"ok": true, "user_id": "U1"}`))
+	}))
+	defer server.Close()
+
+	for _, api_url := range []string{server.URL + "/api", server.URL + "/api/"} {
+		client, err := NewSlackClient(&Source{Token: "xoxb-test", ApiUrl: api_url})
+		if err != nil {
+			t.Fatalf("NewSlackClient(%s) failed: %s", api_url, err)
+		}
+		if _, err := client.AuthTest(); err != nil {
+			t.Errorf("AuthTest() with api_url %s failed: %s", api_url, err)
+		}
+	}
+
+	if strings.Join(paths, " ") != "/api/auth.test /api/auth.test" {
+		t.Errorf("called %v, want /api/auth.test twice", paths)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		source Source
+		check  func(transport *retry_transport) bool
+	}{
+		{
+			name:   "defaults",
+			source: Source{},
+			check: func(transport *retry_transport) bool {
+				return transport.max_attempts == default_max_attempts && transport.max_wait == default_max_wait && transport.timeout == 0
+			},
+		},
+		{
+			name:   "timeout and retry",
+			source: Source{Timeout: "30s", Retry: &RetryConfig{MaxAttempts: 2, MaxWait: "10s"}},
+			check: func(transport *retry_transport) bool {
+				return transport.max_attempts == 2 && transport.max_wait == 10*time.Second && transport.timeout == 30*time.Second
+			},
+		},
+		{
+			name:   "proxy",
+			source: Source{Proxy: "http://proxy.example.com:3128"},
+			check: func(transport *retry_transport) bool {
+				request, _ := http.NewRequest(http.MethodGet, "https://slack.com/api/auth.test", nil)
+				proxy_url, err := transport.next.(*http.Transport).Proxy(request)
+				return err == nil && proxy_url.String() == "http://proxy.example.com:3128"
+			},
+		},
+		{
+			name:   "insecure_skip_verify",
+			source: Source{InsecureSkipVerify: true},
+			check: func(transport *retry_transport) bool {
+				return transport.next.(*http.Transport).TLSClientConfig.InsecureSkipVerify
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := test.source.HTTPClient()
+			if err != nil {
+				t.Fatalf("HTTPClient() failed: %s", err)
+			}
+			if !test.check(client.Transport.(*retry_transport)) {
+				t.Errorf("HTTPClient() = %+v, not configured as expected", client.Transport)
+			}
+		})
+	}
+}
+
+func TestHTTPClientErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source Source
+	}{
+		{name: "ca_certs without PEM", source: Source{CaCerts: "not a certificate"}},
+		{name: "timeout without unit", source: Source{Timeout: "30"}},
+		{name: "timeout not a duration", source: Source{Timeout: "soon"}},
+		{name: "max_wait not a duration", source: Source{Retry: &RetryConfig{MaxWait: "1 minute"}}},
+		{name: "proxy without scheme", source: Source{Proxy: "proxy.example.com:3128"}},
+		{name: "proxy with other scheme", source: Source{Proxy: "ftp://proxy.example.com"}},
+		{name: "proxy without host", source: Source{Proxy: "http://"}},
+		{name: "proxy not a URL", source: Source{Proxy: "http://proxy example com:%zz"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.source.HTTPClient(); err == nil {
+				t.Errorf("HTTPClient() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestHTTPClientTLS(t *testing.T) {
+	record_waits(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	ca_certs := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	no_retry := &RetryConfig{MaxAttempts: 1}
+
+	tests := []struct {
+		name   string
+		source Source
+		fails  bool
+	}{
+		{name: "untrusted", source: Source{Retry: no_retry}, fails: true},
+		{name: "ca_certs", source: Source{Retry: no_retry, CaCerts: ca_certs}},
+		{name: "insecure_skip_verify", source: Source{Retry: no_retry, InsecureSkipVerify: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := test.source.HTTPClient()
+			if err != nil {
+				t.Fatalf("HTTPClient() failed: %s", err)
+			}
+
+			response, err := client.Get(server.URL + "/api/auth.test")
+			if err == nil {
+				response.Body.Close()
+			}
+			if test.fails && err == nil {
+				t.Errorf("request succeeded, want a TLS error")
+			}
+			if !test.fails && err != nil {
+				t.Errorf("request failed: %s", err)
+			}
+		})
+	}
+}
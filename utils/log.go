@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"regexp"
+)
+
+// Log receives the progress and diagnostic messages of the resources. The
+// commands log to stderr, as Concourse reads their result from stdout.
+// Slack tokens and webhook URLs are redacted, so that they never end up in
+// build logs.
+var Log io.Writer = NewRedactingWriter(os.Stderr)
+
+// Slack bot, user, app and configuration tokens, and incoming webhook URLs.
+var token_pattern = regexp.MustCompile(`\b(xox[a-z]|xapp)-[A-Za-z0-9-]+`)
+var webhook_pattern = regexp.MustCompile(`\b(hooks\.slack(-gov)?\.com/services)/[A-Za-z0-9/]+`)
+
+type redacting_writer struct {
+	next io.Writer
+}
+
+// NewRedactingWriter returns a writer replacing Slack tokens with a redacted
+// placeholder before writing to next.
+func NewRedactingWriter(next io.Writer) io.Writer {
+	return &redacting_writer{next}
+}
+
+func (writer *redacting_writer) Write(data []byte) (int, error) {
+	_, err := writer.next.Write(Redact(data))
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Redact replaces Slack tokens and webhook URLs in data, keeping their
+// prefix, e.g. "xoxb-[REDACTED]".
+func Redact(data []byte) []byte {
+	data = token_pattern.ReplaceAll(data, []byte("${1}-[REDACTED]"))
+	return webhook_pattern.ReplaceAll(data, []byte("${1}/[REDACTED]"))
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// ReactionFilter matches messages having one of the emoji reactions, added by
+// one of the users if any are given. In the source, it is either an emoji
+// name, a list of names, or an object with `names` and `users`.
+type ReactionFilter struct {
+	Names []string `json:"names"`
+	Users []string `json:"users"`
+}
+
+func (filter *ReactionFilter) UnmarshalJSON(payload []byte) error {
+	var name string
+	if err := json.Unmarshal(payload, &name); err == nil {
+		*filter = ReactionFilter{Names: []string{name}}
+		return filter.normalize()
+	}
+
+	var names []string
+	if err := json.Unmarshal(payload, &names); err == nil {
+		*filter = ReactionFilter{Names: names}
+		return filter.normalize()
+	}
+
+	// Decode the object form without recursing into this method.
+	type object ReactionFilter
+	var value object
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return fmt.Errorf("expected an emoji name, a list of names, or an object with names and users: %w", err)
+	}
+
+	*filter = ReactionFilter(value)
+	return filter.normalize()
+}
+
+// normalize strips the colons around emoji names, and checks that some are given.
+func (filter *ReactionFilter) normalize() error {
+	names := []string{}
+	for _, name := range filter.Names {
+		name = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(name), ":"), ":")
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return fmt.Errorf("expected at least one emoji name")
+	}
+
+	filter.Names = names
+	return nil
+}
+
+// Match reports whether one of the reactions matches the filter. A name
+// without skin tone also matches its skin tone variants, e.g. "+1" matches
+// "+1::skin-tone-2".
+func (filter *ReactionFilter) Match(reactions []slack.ItemReaction) bool {
+	for _, reaction := range reactions {
+		if !filter.match_name(reaction.Name) {
+			continue
+		}
+
+		if len(filter.Users) == 0 {
+			return true
+		}
+
+		for _, user := range reaction.Users {
+			for _, wanted := range filter.Users {
+				if user == wanted {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (filter *ReactionFilter) match_name(name string) bool {
+	for _, wanted := range filter.Names {
+		if name == wanted || strings.HasPrefix(name, wanted+"::") {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter *ReactionFilter) String() string {
+	if len(filter.Users) == 0 {
+		return strings.Join(filter.Names, ", ")
+	}
+	return strings.Join(filter.Names, ", ") + " by " + strings.Join(filter.Users, ", ")
+}
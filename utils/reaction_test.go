@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestReactionFilterUnmarshal(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+		fails   bool
+	}{
+		{payload: `"white_check_mark"`, want: "white_check_mark"},
+		{payload: `":white_check_mark:"`, want: "white_check_mark"},
+		{payload: `["+1", ":rocket:"]`, want: "+1, rocket"},
+		{payload: `{"names": ["white_check_mark"], "users": ["U1", "U2"]}`, want: "white_check_mark by U1, U2"},
+		{payload: `""`, fails: true},
+		{payload: `[]`, fails: true},
+		{payload: `{"users": ["U1"]}`, fails: true},
+		{payload: `42`, fails: true},
+	}
+
+	for _, test := range tests {
+		var filter ReactionFilter
+		err := json.Unmarshal([]byte(test.payload), &filter)
+		if test.fails {
+			if err == nil {
+				t.Errorf("decoding %s succeeded, want an error", test.payload)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decoding %s failed: %s", test.payload, err)
+			continue
+		}
+		if fmt.Sprint(&filter) != test.want {
+			t.Errorf("decoding %s = %s, want %s", test.payload, &filter, test.want)
+		}
+	}
+}
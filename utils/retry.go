@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RetryConfig struct {
+	MaxAttempts int    `json:"max_attempts"`
+	MaxWait     string `json:"max_wait"`
+}
+
+const default_max_attempts = 5
+const default_max_wait = 2 * time.Minute
+
+// Backoff bounds for server and network errors.
+const min_backoff = time.Second
+const max_backoff = 30 * time.Second
+
+// Slack API methods that must not be sent twice: a call failing with a server
+// or network error may still have been processed. Rate limited calls are
+// rejected before being processed, so they are retried regardless.
+var non_idempotent_methods = map[string]bool{
+	"chat.postMessage":             true,
+	"chat.postEphemeral":           true,
+	"chat.scheduleMessage":         true,
+	"files.completeUploadExternal": true,
+}
+
+// after waits between attempts, replaced in tests to record the delays.
+var after = time.After
+
+// retry_transport retries rate limited calls after the Retry-After delay, and
+// idempotent calls failing with a server or network error after a jittered
+// exponential backoff. Each attempt is bounded by the timeout, if any.
+type retry_transport struct {
+	next         http.RoundTripper
+	max_attempts int
+	max_wait     time.Duration
+	timeout      time.Duration
+}
+
+func (transport *retry_transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	method := path.Base(request.URL.Path)
+	idempotent := !non_idempotent_methods[method]
+
+	// Web API methods are named like chat.postMessage. Other calls, like
+	// incoming webhooks, post messages and whatever else is in their URL.
+	if !strings.Contains(method, ".") {
+		method = request.URL.Host
+		idempotent = false
+	}
+	waited := time.Duration(0)
+
+	for attempt := 1; ; attempt++ {
+		response, err := transport.attempt(request)
+
+		delay, reason := retry_delay(response, err, idempotent, attempt)
+		if len(reason) == 0 || attempt >= transport.max_attempts || waited+delay > transport.max_wait {
+			return response, err
+		}
+
+		// Requests streaming their body, like file uploads, cannot be sent again.
+		if request.Body != nil && request.GetBody == nil {
+			return response, err
+		}
+
+		if response != nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		fmt.Fprintf(Log, "Slack API %s: %s, retrying in %s (attempt %d of %d).\n",
+			method, reason, delay.Round(time.Millisecond), attempt+1, transport.max_attempts)
+
+		select {
+		case <-after(delay):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+		waited += delay
+
+		request = request.Clone(request.Context())
+		if request.GetBody != nil {
+			body, body_err := request.GetBody()
+			if body_err != nil {
+				return nil, body_err
+			}
+			request.Body = body
+		}
+	}
+}
+
+func (transport *retry_transport) attempt(request *http.Request) (*http.Response, error) {
+	if transport.timeout <= 0 {
+		return transport.next.RoundTrip(request)
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), transport.timeout)
+
+	response, err := transport.next.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The timeout also bounds reading the response body.
+	response.Body = &cancel_body{response.Body, cancel}
+
+	return response, nil
+}
+
+type cancel_body struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancel_body) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// retry_delay returns how long to wait before retrying a call, and why, or an
+// empty reason if the call must not be retried.
+func retry_delay(response *http.Response, err error, idempotent bool, attempt int) (time.Duration, string) {
+	if err != nil {
+		if !idempotent {
+			return 0, ""
+		}
+		return backoff(attempt), err.Error()
+	}
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		delay := min_backoff
+		if seconds, parse_err := strconv.Atoi(response.Header.Get("Retry-After")); parse_err == nil && seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		// Avoid all waiting clients hitting the API again at the same time.
+		delay += rand.N(time.Second)
+		return delay, "rate limited"
+	}
+
+	if response.StatusCode >= 500 && idempotent {
+		return backoff(attempt), response.Status
+	}
+
+	return 0, ""
+}
+
+// backoff returns a jittered exponential delay for the given attempt.
+func backoff(attempt int) time.Duration {
+	delay := max_backoff
+	if attempt < 6 {
+		delay = min(min_backoff<<(attempt-1), max_backoff)
+	}
+	return delay/2 + rand.N(delay/2)
+}
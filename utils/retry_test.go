@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fake_api answers each call with the next status of its script, then with
+// 200 OK. A status of 0 closes the connection, as a network error would.
+type fake_api struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	headers  []http.Header
+	bodies   []string
+}
+
+func new_fake_api(t *testing.T, statuses ...int) *fake_api {
+	api := &fake_api{statuses: statuses}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.handle))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (api *fake_api) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	api.mu.Lock()
+	attempt := len(api.bodies)
+	api.bodies = append(api.bodies, string(body))
+	status := http.StatusOK
+	header := http.Header{}
+	if attempt < len(api.statuses) {
+		status = api.statuses[attempt]
+	}
+	if attempt < len(api.headers) {
+		header = api.headers[attempt]
+	}
+	api.mu.Unlock()
+
+	if status == 0 {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(`{"ok": true}`))
+}
+
+func (api *fake_api) attempts() int {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return len(api.bodies)
+}
+
+// record_waits makes the retry transport return at once, recording the
+// delays it would have waited.
+func record_waits(t *testing.T) *[]time.Duration {
+	waits := &[]time.Duration{}
+	after = func(delay time.Duration) <-chan time.Time {
+		*waits = append(*waits, delay)
+		ready := make(chan time.Time, 1)
+		ready <- time.Now()
+		return ready
+	}
+	t.Cleanup(func() { after = time.After })
+	return waits
+}
+
+func new_retry_client(max_attempts int, max_wait time.Duration) *http.Client {
+	return &http.Client{Transport: &retry_transport{
+		next:         http.DefaultTransport,
+		max_attempts: max_attempts,
+		max_wait:     max_wait,
+	}}
+}
+
+func post(t *testing.T, client *http.Client, url string, body string) (int, error) {
+	t.Helper()
+
+	response, err := client.Post(url, "application/x-www-form-urlencoded", strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
+
+func TestRetryStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		statuses []int
+		status   int
+		fails    bool
+		attempts int
+	}{
+		{name: "success", path: "/api/conversations.history", statuses: nil, status: 200, attempts: 1},
+		{name: "server error", path: "/api/conversations.history", statuses: []int{500, 503}, status: 200, attempts: 3},
+		{name: "network error", path: "/api/conversations.history", statuses: []int{0}, status: 200, attempts: 2},
+		{name: "client error", path: "/api/conversations.history", statuses: []int{400}, status: 400, attempts: 1},
+		{name: "rate limited post", path: "/api/chat.postMessage", statuses: []int{429}, status: 200, attempts: 2},
+		{name: "post server error", path: "/api/chat.postMessage", statuses: []int{500}, status: 500, attempts: 1},
+		{name: "post network error", path: "/api/chat.postMessage", statuses: []int{0}, fails: true, attempts: 1},
+		{name: "upload completion", path: "/api/files.completeUploadExternal", statuses: []int{502}, status: 502, attempts: 1},
+		{name: "webhook server error", path: "/services/T00000000/B00000000/secret", statuses: []int{500}, status: 500, attempts: 1},
+		{name: "webhook network error", path: "/services/T00000000/B00000000/secret", statuses: []int{0}, fails: true, attempts: 1},
+		{name: "rate limited webhook", path: "/services/T00000000/B00000000/secret", statuses: []int{429}, status: 200, attempts: 2},
+		{name: "upload URL server error", path: "/upload/v1/ABC123", statuses: []int{500}, status: 500, attempts: 1},
+		{name: "max attempts", path: "/api/conversations.history", statuses: []int{500, 500, 500, 500}, status: 500, attempts: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			record_waits(t)
+			api := new_fake_api(t, test.statuses...)
+
+			status, err := post(t, new_retry_client(3, time.Minute), api.URL+test.path, "channel=C1")
+			if test.fails && err == nil {
+				t.Errorf("got status %d, want an error", status)
+			}
+			if !test.fails && err != nil {
+				t.Errorf("failed: %s", err)
+			}
+			if !test.fails && status != test.status {
+				t.Errorf("got status %d, want %d", status, test.status)
+			}
+			if api.attempts() != test.attempts {
+				t.Errorf("made %d attempts, want %d", api.attempts(), test.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	waits := record_waits(t)
+	api := new_fake_api(t, 429)
+	api.headers = []http.Header{{"Retry-After": []string{"7"}}}
+
+	status, err := post(t, new_retry_client(3, time.Minute), api.URL+"/api/chat.postMessage", "text=hi")
+	if err != nil || status != 200 {
+		t.Fatalf("got status %d, error %v, want 200", status, err)
+	}
+
+	if len(*waits) != 1 || (*waits)[0] < 7*time.Second || (*waits)[0] >= 8*time.Second {
+		t.Errorf("waited %v, want the 7s of Retry-After plus less than 1s of jitter", *waits)
+	}
+}
+
+func TestRetryMaxWait(t *testing.T) {
+	waits := record_waits(t)
+	api := new_fake_api(t, 429)
+	api.headers = []http.Header{{"Retry-After": []string{"30"}}}
+
+	status, err := post(t, new_retry_client(3, 10*time.Second), api.URL+"/api/conversations.history", "")
+	if err != nil || status != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, error %v, want 429", status, err)
+	}
+
+	if len(*waits) != 0 || api.attempts() != 1 {
+		t.Errorf("waited %v over %d attempts, want no retry beyond max_wait", *waits, api.attempts())
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	record_waits(t)
+	api := new_fake_api(t, 429, 503)
+
+	status, err := post(t, new_retry_client(5, time.Minute), api.URL+"/api/reactions.add", "name=eyes&timestamp=1234.5678")
+	if err != nil || status != 200 {
+		t.Fatalf("got status %d, error %v, want 200", status, err)
+	}
+
+	want := []string{"name=eyes&timestamp=1234.5678", "name=eyes&timestamp=1234.5678", "name=eyes&timestamp=1234.5678"}
+	if strings.Join(api.bodies, "|") != strings.Join(want, "|") {
+		t.Errorf("bodies = %q, want %q", api.bodies, want)
+	}
+}
+
+func TestRetryStreamedBody(t *testing.T) {
+	record_waits(t)
+	api := new_fake_api(t, 503)
+
+	// Without GetBody, the body cannot be sent again.
+	request, err := http.NewRequest(http.MethodPost, api.URL+"/api/conversations.history", io.NopCloser(bytes.NewBufferString("channel=C1")))
+	if err != nil {
+		t.Fatalf("creating request: %s", err)
+	}
+
+	response, err := new_retry_client(3, time.Minute).Do(request)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != 503 || api.attempts() != 1 {
+		t.Errorf("got status %d after %d attempts, want 503 after 1", response.StatusCode, api.attempts())
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ResolveToken sets Token from TokenFile or TokenEnv when it is not given
+// inline, e.g. to read it from a file mounted by a credential manager.
+func (source *Source) ResolveToken() error {
+	given := 0
+	for _, field := range []string{source.Token, source.TokenFile, source.TokenEnv} {
+		if len(field) > 0 {
+			given++
+		}
+	}
+
+	switch {
+	case given == 0:
+		return errors.New("missing source field: token, token_file or token_env")
+	case given > 1:
+		return errors.New("only one of source fields token, token_file and token_env can be given")
+	}
+
+	if len(source.TokenFile) > 0 {
+		data, err := os.ReadFile(source.TokenFile)
+		if err != nil {
+			return fmt.Errorf("reading source field token_file: %w", err)
+		}
+		source.Token = strings.TrimSpace(string(data))
+		if len(source.Token) == 0 {
+			return fmt.Errorf("token file %s is empty", source.TokenFile)
+		}
+	}
+
+	if len(source.TokenEnv) > 0 {
+		source.Token = strings.TrimSpace(os.Getenv(source.TokenEnv))
+		if len(source.Token) == 0 {
+			return fmt.Errorf("environment variable %s from source field token_env is not set", source.TokenEnv)
+		}
+	}
+
+	return nil
+}
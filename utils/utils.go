@@ -1,8 +1,12 @@
 package utils
 
 import (
-	//"strings"
+	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"strings"
+
 	//"errors"
 	"encoding/json"
 
@@ -12,15 +16,46 @@ import (
 type Regexp struct{ regexp.Regexp }
 
 type MessageFilter struct {
-	AuthorId    string  `json:"author"`
-	TextPattern *Regexp `json:"text_pattern"`
+	AuthorId        string          `json:"author"`
+	Authors         []string        `json:"authors"`
+	NotAuthors      []string        `json:"not_authors"`
+	Usergroup       string          `json:"usergroup"`
+	BotOnly         bool            `json:"bot_only"`
+	HumansOnly      bool            `json:"humans_only"`
+	Subtypes        []string        `json:"subtypes"`
+	ExcludeSubtypes []string        `json:"exclude_subtypes"`
+	TextPattern     *Regexp         `json:"text_pattern"`
+	HasReaction     *ReactionFilter `json:"has_reaction"`
+	NotReactedWith  *ReactionFilter `json:"not_reacted_with"`
+
+	// Members of the usergroup, looked up before matching messages.
+	UsergroupMembers []string `json:"-"`
 }
 
 type Source struct {
 	Token       string         `json:"token"`
+	TokenFile   string         `json:"token_file"`
+	TokenEnv    string         `json:"token_env"`
+	WebhookUrl  string         `json:"webhook_url"`
 	ChannelId   string         `json:"channel_id"`
+	ChannelName string         `json:"channel_name"`
 	Filter      *MessageFilter `json:"matching"`
 	ReplyFilter *MessageFilter `json:"not_replied_by"`
+	MaxPages    int            `json:"max_pages"`
+	MaxMessages int            `json:"max_messages"`
+
+	IncludeReplies bool   `json:"include_replies"`
+	IncludeEdits   bool   `json:"include_edits"`
+	ThreadTs       string `json:"thread_ts"`
+	ThreadLookback string `json:"thread_lookback"`
+
+	Retry *RetryConfig `json:"retry"`
+
+	ApiUrl             string `json:"api_url"`
+	Proxy              string `json:"proxy"`
+	CaCerts            string `json:"ca_certs"`
+	Timeout            string `json:"timeout"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
 }
 
 type Version map[string]string
@@ -44,16 +79,25 @@ type InResponse struct {
 }
 
 type InParams struct {
-	TextPattern *Regexp `json:"text_pattern"`
+	TextPattern Regexps `json:"text_pattern"`
 }
 
 type OutParams struct {
-	Message              *OutMessage `json:"message"`
-	MessageFile          string      `json:"message_file"`
-	Ts                   string      `json:"update_ts"`
-	Upload               *Upload     `json:"upload"`
-	EmojiReactions       []string    `json:"emoji_reactions"`
-	ThreadEmojiReactions []string    `json:"thread_emoji_reactions"`
+	Message                *OutMessage `json:"message"`
+	Channels               []string    `json:"channels"`
+	DmUsers                []string    `json:"dm_users"`
+	MessageFile            string      `json:"message_file"`
+	InterpolateMessageFile bool        `json:"interpolate_message_file"`
+	Ts                     string      `json:"update_ts"`
+	DeleteTs               string      `json:"delete_ts"`
+	DeleteThread           bool        `json:"delete_thread"`
+	PostAt                 string      `json:"post_at"`
+	CancelScheduled        string      `json:"cancel_scheduled"`
+	EphemeralUser          string      `json:"ephemeral_user"`
+	Upload                 *Upload     `json:"upload"`
+	EmojiReactions         []string    `json:"emoji_reactions"`
+	ThreadEmojiReactions   []string    `json:"thread_emoji_reactions"`
+	TemplateEngine         string      `json:"template_engine"`
 }
 
 type OutRequest struct {
@@ -61,8 +105,26 @@ type OutRequest struct {
 	Params OutParams `json:"params"`
 }
 
+// ReactParams are the params of a put to the read resource, acting on a
+// message fetched by a previous get.
+type ReactParams struct {
+	MessageDir      string   `json:"message_dir"`
+	AddReactions    []string `json:"add_reactions"`
+	RemoveReactions []string `json:"remove_reactions"`
+	Reply           string   `json:"reply"`
+	ReplyFile       string   `json:"reply_file"`
+	ReplyBroadcast  bool     `json:"reply_broadcast"`
+}
+
+type ReactRequest struct {
+	Source Source      `json:"source"`
+	Params ReactParams `json:"params"`
+}
+
 type OutMessage struct {
-	Text string `json:"text"`
+	Text        string             `json:"text"`
+	Blocks      slack.Blocks       `json:"blocks"`
+	Attachments []slack.Attachment `json:"attachments"`
 	slack.PostMessageParameters
 }
 
@@ -108,3 +170,152 @@ func (r *Regexp) UnmarshalJSON(payload []byte) error {
 
 	return nil
 }
+
+// Regexps are regular expressions tried in order. In params, they are either
+// a single pattern or a list of patterns.
+type Regexps []*Regexp
+
+func (r *Regexps) UnmarshalJSON(payload []byte) error {
+	var text string
+	if err := json.Unmarshal(payload, &text); err == nil {
+		var pattern Regexp
+		if err := pattern.UnmarshalJSON(payload); err != nil {
+			return err
+		}
+		*r = Regexps{&pattern}
+		return nil
+	}
+
+	var patterns []*Regexp
+	if err := json.Unmarshal(payload, &patterns); err != nil {
+		return fmt.Errorf("expected a pattern or a list of patterns: %w", err)
+	}
+
+	*r = Regexps(patterns)
+	return nil
+}
+
+// Clone returns a copy of the source to resolve names in. Its message filters
+// are copied, sharing their compiled patterns and reaction filters, which are
+// never modified.
+func (source Source) Clone() Source {
+	source.Filter = clone_filter(source.Filter)
+	source.ReplyFilter = clone_filter(source.ReplyFilter)
+	return source
+}
+
+func clone_filter(filter *MessageFilter) *MessageFilter {
+	if filter == nil {
+		return nil
+	}
+
+	clone := *filter
+	clone.Authors = slices.Clone(filter.Authors)
+	clone.NotAuthors = slices.Clone(filter.NotAuthors)
+	clone.Subtypes = slices.Clone(filter.Subtypes)
+	clone.ExcludeSubtypes = slices.Clone(filter.ExcludeSubtypes)
+	clone.UsergroupMembers = slices.Clone(filter.UsergroupMembers)
+	return &clone
+}
+
+// Clone returns a copy of the request with its source and version copied.
+func (request *CheckRequest) Clone() *CheckRequest {
+	return &CheckRequest{Source: request.Source.Clone(), Version: maps.Clone(request.Version)}
+}
+
+// Clone returns a copy of the request with its source and version copied.
+// The patterns of its params are shared.
+func (request *InRequest) Clone() *InRequest {
+	return &InRequest{Source: request.Source.Clone(), Version: maps.Clone(request.Version), Params: request.Params}
+}
+
+// Clone returns a copy of the request with its source copied. The reaction
+// lists of its params are shared.
+func (request *ReactRequest) Clone() *ReactRequest {
+	return &ReactRequest{Source: request.Source.Clone(), Params: request.Params}
+}
+
+// Clone returns a copy of the request with its source and params copied,
+// including params.message, to interpolate. The other lists and the upload
+// of its params are shared.
+func (request *OutRequest) Clone() *OutRequest {
+	clone := &OutRequest{Source: request.Source.Clone(), Params: request.Params}
+	if request.Params.Message != nil {
+		message := *request.Params.Message
+		clone.Params.Message = &message
+	}
+	return clone
+}
+
+// ChannelLister is the part of the Slack API used to look channels up by
+// name, implemented by *slack.Client.
+type ChannelLister interface {
+	GetConversations(params *slack.GetConversationsParameters) ([]slack.Channel, string, error)
+}
+
+// ResolveChannelId sets ChannelId from ChannelName when no ChannelId is given.
+func (source *Source) ResolveChannelId(slack_client ChannelLister) error {
+	if len(source.ChannelId) > 0 {
+		return nil
+	}
+
+	if len(strings.TrimSpace(source.ChannelName)) == 0 {
+		return fmt.Errorf("missing source field: channel_id or channel_name")
+	}
+
+	id, err := FindChannelId(slack_client, source.ChannelName)
+	if err != nil {
+		return err
+	}
+
+	source.ChannelId = id
+
+	return nil
+}
+
+// FindChannelId looks a channel name, with or without a leading #, up among
+// the public and private channels visible to the token.
+func FindChannelId(slack_client ChannelLister, channel_name string) (string, error) {
+	name := strings.TrimPrefix(strings.TrimSpace(channel_name), "#")
+
+	params := slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Limit:           1000,
+		Types:           []string{"public_channel", "private_channel"},
+	}
+
+	matches := []slack.Channel{}
+
+	for {
+		channels, cursor, err := slack_client.GetConversations(&params)
+		if err != nil {
+			return "", fmt.Errorf("listing channels: %w", err)
+		}
+
+		for _, channel := range channels {
+			if channel.Name == name {
+				matches = append(matches, channel)
+			}
+		}
+
+		if len(cursor) == 0 {
+			break
+		}
+		params.Cursor = cursor
+	}
+
+	switch {
+	case len(matches) == 0:
+		return "", fmt.Errorf("channel #%s not found, or not visible to the token (private channels require the app to be a member)", name)
+	case len(matches) > 1:
+		ids := []string{}
+		for _, channel := range matches {
+			ids = append(ids, channel.ID)
+		}
+		return "", fmt.Errorf("channel name #%s is ambiguous, use one of the channel IDs instead: %s", name, strings.Join(ids, ", "))
+	case !matches[0].IsMember:
+		return "", fmt.Errorf("the app is not a member of channel #%s (%s), invite it to the channel first", name, matches[0].ID)
+	}
+
+	return matches[0].ID, nil
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/apptweak/concourse-slack-chat-resources/test/fakeslack"
+)
+
+func TestFindChannelId(t *testing.T) {
+	server := fakeslack.New()
+	defer server.Close()
+
+	server.AddChannel("C00000001", "deploys", true)
+	server.AddChannel("C00000002", "releases", true)
+	server.AddChannel("C00000003", "releases", true)
+	server.AddChannel("C00000004", "private", false)
+
+	tests := []struct {
+		name    string
+		channel string
+		want    string
+		err     string
+	}{
+		{name: "name", channel: "deploys", want: "C00000001"},
+		{name: "name with #", channel: " #deploys ", want: "C00000001"},
+		{name: "missing channel", channel: "#unknown", err: "channel #unknown not found"},
+		{name: "ambiguous name", channel: "#releases", err: "ambiguous, use one of the channel IDs instead: C00000002, C00000003"},
+		{name: "app not a member", channel: "#private", err: "the app is not a member of channel #private (C00000004)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := FindChannelId(server.Client(), test.channel)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("FindChannelId(%s) = %s, %v, want an error containing %q", test.channel, id, err, test.err)
+				}
+				return
+			}
+			if err != nil || id != test.want {
+				t.Errorf("FindChannelId(%s) = %s, %v, want %s", test.channel, id, err, test.want)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	var check CheckRequest
+	payload := `{
+		"source": {"channel_name": "#deploys", "matching": {"authors": ["a@example.com"]}, "not_replied_by": {"not_authors": ["b@example.com"]}},
+		"version": {"timestamp": "1234.5678"}
+	}`
+	if err := json.Unmarshal([]byte(payload), &check); err != nil {
+		t.Fatalf("parsing request: %s", err)
+	}
+	before, _ := json.Marshal(check)
+
+	clone := check.Clone()
+	clone.Source.ChannelId = "C00000001"
+	clone.Source.Filter.Authors[0] = "U1"
+	clone.Source.ReplyFilter.NotAuthors[0] = "U2"
+	clone.Version["timestamp"] = "0000.0000"
+
+	if after, _ := json.Marshal(check); string(after) != string(before) {
+		t.Errorf("changing the clone changed the check request:\n%s\nwant:\n%s", after, before)
+	}
+
+	var out OutRequest
+	if err := json.Unmarshal([]byte(`{"source": {}, "params": {"message": {"text": "hi"}}}`), &out); err != nil {
+		t.Fatalf("parsing request: %s", err)
+	}
+
+	out_clone := out.Clone()
+	out_clone.Params.Message.Text = "changed"
+	if out.Params.Message.Text != "hi" {
+		t.Errorf("changing the clone changed the message to %q", out.Params.Message.Text)
+	}
+}